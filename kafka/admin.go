@@ -0,0 +1,251 @@
+// Package kafka declares topics at service startup, producing and consuming
+// live in the producer and consumer subpackages.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	kafkago "github.com/segmentio/kafka-go"
+	"sort"
+	"time"
+)
+
+const (
+	ConfigRetentionMs   = "retention.ms"
+	ConfigCleanupPolicy = "cleanup.policy"
+
+	CleanupPolicyDelete  = "delete"
+	CleanupPolicyCompact = "compact"
+
+	defaultAdminTimeout = 10 * time.Second
+	// DescribeConfigs v1+ sources, v0 reports unknown with IsDefault instead
+	configSourceUnknown = 0
+	configSourceTopic   = 1
+)
+
+var (
+	ErrEmptyBrokers       = errors.New("brokers are empty")
+	ErrTopicNotFound      = errors.New("topic not found")
+	ErrTopicPartitions    = errors.New("topic has fewer partitions than required")
+	ErrDecreasePartitions = errors.New("partitions can't be decreased")
+)
+
+// TopicSpec is a required topic, zero Partitions and ReplicationFactor leave
+// the choice to the broker defaults
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	// Configs are topic level configs, e.g. retention.ms or cleanup.policy
+	Configs map[string]string
+}
+
+type TopicInfo struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	// Configs has only values set on the topic, not broker defaults
+	Configs map[string]string
+}
+
+type Admin struct {
+	client *kafkago.Client
+}
+
+func NewAdmin(brokers []string) (*Admin, error) {
+	if len(brokers) == 0 {
+		return nil, ErrEmptyBrokers
+	}
+	return &Admin{
+		client: &kafkago.Client{
+			Addr:    kafkago.TCP(brokers...),
+			Timeout: defaultAdminTimeout,
+		},
+	}, nil
+}
+
+// EnsureTopics calls EnsureTopic for every spec and joins the errors
+func (a *Admin) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	var err error
+	for _, spec := range specs {
+		err = errors.Join(err, a.EnsureTopic(ctx, spec))
+	}
+	return err
+}
+
+// EnsureTopic creates the topic or updates configs of an existing one. It never
+// adds partitions, that changes the partition of keys, an existing topic with
+// fewer partitions is ErrTopicPartitions, see IncreasePartitions.
+func (a *Admin) EnsureTopic(ctx context.Context, spec TopicSpec) error {
+	created, err := a.createTopic(ctx, spec)
+	if err != nil || created {
+		return err
+	}
+
+	info, err := a.DescribeTopic(ctx, spec.Name)
+	if err != nil {
+		return err
+	}
+	if info.Partitions < spec.Partitions {
+		return fmt.Errorf("%w: %s has %d, required %d", ErrTopicPartitions, spec.Name, info.Partitions, spec.Partitions)
+	}
+
+	changed := make([]kafkago.IncrementalAlterConfigsRequestConfig, 0, len(spec.Configs))
+	for name, value := range spec.Configs {
+		if current, ok := info.Configs[name]; ok && current == value {
+			continue
+		}
+		changed = append(changed, kafkago.IncrementalAlterConfigsRequestConfig{
+			Name:            name,
+			Value:           value,
+			ConfigOperation: kafkago.ConfigOperationSet,
+		})
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	resp, err := a.client.IncrementalAlterConfigs(ctx, &kafkago.IncrementalAlterConfigsRequest{
+		Resources: []kafkago.IncrementalAlterConfigsRequestResource{{
+			ResourceType: kafkago.ResourceTypeTopic,
+			ResourceName: spec.Name,
+			Configs:      changed,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("alter topic %s configs: %w", spec.Name, err)
+	}
+	for _, res := range resp.Resources {
+		if res.Error != nil {
+			return fmt.Errorf("alter topic %s configs: %w", spec.Name, res.Error)
+		}
+	}
+	return nil
+}
+
+func (a *Admin) createTopic(ctx context.Context, spec TopicSpec) (bool, error) {
+	partitions, replication := spec.Partitions, spec.ReplicationFactor
+	if partitions <= 0 {
+		partitions = -1
+	}
+	if replication <= 0 {
+		replication = -1
+	}
+	configs := make([]kafkago.ConfigEntry, 0, len(spec.Configs))
+	for name, value := range spec.Configs {
+		configs = append(configs, kafkago.ConfigEntry{ConfigName: name, ConfigValue: value})
+	}
+
+	resp, err := a.client.CreateTopics(ctx, &kafkago.CreateTopicsRequest{
+		Topics: []kafkago.TopicConfig{{
+			Topic:             spec.Name,
+			NumPartitions:     partitions,
+			ReplicationFactor: replication,
+			ConfigEntries:     configs,
+		}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("create topic %s: %w", spec.Name, err)
+	}
+	switch err := resp.Errors[spec.Name]; {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, kafkago.TopicAlreadyExists):
+		return false, nil
+	default:
+		return false, fmt.Errorf("create topic %s: %w", spec.Name, err)
+	}
+}
+
+// ListTopics returns names of all topics except internal ones
+func (a *Admin) ListTopics(ctx context.Context) ([]string, error) {
+	resp, err := a.client.Metadata(ctx, &kafkago.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("list topics: %w", err)
+	}
+
+	topics := make([]string, 0, len(resp.Topics))
+	for _, t := range resp.Topics {
+		if !t.Internal {
+			topics = append(topics, t.Name)
+		}
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+func (a *Admin) DescribeTopic(ctx context.Context, name string) (TopicInfo, error) {
+	meta, err := a.client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{name}})
+	if err != nil {
+		return TopicInfo{}, fmt.Errorf("describe topic %s: %w", name, err)
+	}
+	if len(meta.Topics) == 0 || errors.Is(meta.Topics[0].Error, kafkago.UnknownTopicOrPartition) {
+		return TopicInfo{}, fmt.Errorf("%w: %s", ErrTopicNotFound, name)
+	}
+	topic := meta.Topics[0]
+	if topic.Error != nil {
+		return TopicInfo{}, fmt.Errorf("describe topic %s: %w", name, topic.Error)
+	}
+
+	info := TopicInfo{
+		Name:       name,
+		Partitions: len(topic.Partitions),
+		Configs:    make(map[string]string),
+	}
+	if len(topic.Partitions) > 0 {
+		info.ReplicationFactor = len(topic.Partitions[0].Replicas)
+	}
+
+	configs, err := a.client.DescribeConfigs(ctx, &kafkago.DescribeConfigsRequest{
+		Resources: []kafkago.DescribeConfigRequestResource{{
+			ResourceType: kafkago.ResourceTypeTopic,
+			ResourceName: name,
+		}},
+	})
+	if err != nil {
+		return TopicInfo{}, fmt.Errorf("describe topic %s configs: %w", name, err)
+	}
+	for _, res := range configs.Resources {
+		if res.Error != nil {
+			return TopicInfo{}, fmt.Errorf("describe topic %s configs: %w", name, res.Error)
+		}
+		for _, entry := range res.ConfigEntries {
+			topicLevel := entry.ConfigSource == configSourceTopic ||
+				entry.ConfigSource == configSourceUnknown && !entry.IsDefault
+			if topicLevel && !entry.IsSensitive {
+				info.Configs[entry.ConfigName] = entry.ConfigValue
+			}
+		}
+	}
+	return info, nil
+}
+
+// IncreasePartitions sets the partition count of the topic. Keys written after
+// it may land in other partitions, so per key order is lost across the change.
+func (a *Admin) IncreasePartitions(ctx context.Context, name string, count int) error {
+	info, err := a.DescribeTopic(ctx, name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case count == info.Partitions:
+		return nil
+	case count < info.Partitions:
+		return fmt.Errorf("%w: %s has %d, requested %d", ErrDecreasePartitions, name, info.Partitions, count)
+	}
+
+	resp, err := a.client.CreatePartitions(ctx, &kafkago.CreatePartitionsRequest{
+		Topics: []kafkago.TopicPartitionsConfig{{
+			Name:  name,
+			Count: int32(count),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("increase topic %s partitions: %w", name, err)
+	}
+	if err := resp.Errors[name]; err != nil {
+		return fmt.Errorf("increase topic %s partitions: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultBatchTimeout = time.Second
+)
+
+// BatchConfig limits a batch, it is handled when Size messages of one partition
+// are collected or Timeout has passed since the first of them.
+type BatchConfig struct {
+	Size    int
+	Timeout time.Duration
+}
+
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, msgs []kafka.Message) error
+}
+
+type BatchHandlerFunc func(ctx context.Context, msgs []kafka.Message) error
+
+func (f BatchHandlerFunc) HandleBatch(ctx context.Context, msgs []kafka.Message) error {
+	return f(ctx, msgs)
+}
+
+// BatchError reports a partial failure: messages before Index are handled,
+// the message at Index failed with Err and the rest were not handled.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch message %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// NewBatchConsumer is NewConsumer with messages of one partition handled in
+// batches. The highest offset is committed after the batch succeeds. When the
+// handler returns *BatchError the handled prefix is committed, the failed message
+// goes through the Retry policy alone and the rest is handled as a new batch.
+// Any other error makes every message of the batch go through the policy alone.
+// Middlewares such as Dedup only wrap messages handled alone, not HandleBatch.
+func NewBatchConsumer(config Config, handler BatchHandler, opts ...OptionFunc) (*Consumer, error) {
+	if config.Batch.Size <= 0 {
+		config.Batch.Size = defaultBatchSize
+	}
+	if config.Batch.Timeout <= 0 {
+		config.Batch.Timeout = defaultBatchTimeout
+	}
+
+	c, err := NewConsumer(config, HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+		return handler.HandleBatch(ctx, []kafka.Message{msg})
+	}), opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.batchHandler = handler
+	return c, nil
+}
+
+type pendingBatch struct {
+	msgs     []kafka.Message
+	deadline time.Time
+}
+
+func (c *Consumer) workBatch(ctx context.Context, reader Reader, queue <-chan kafka.Message) error {
+	batches := make(map[partitionKey]*pendingBatch)
+	timer := time.NewTimer(c.cfg.Batch.Timeout)
+	defer timer.Stop()
+
+	for {
+		timer.Reset(time.Until(nextDeadline(batches, c.cfg.Batch.Timeout)))
+		select {
+		case msg, ok := <-queue:
+			// pending batches are not committed, they will be fetched again
+			if !ok || ctx.Err() != nil {
+				return nil
+			}
+			if err := waitRetry(ctx, msg); err != nil {
+				return nil
+			}
+
+			key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+			batch, ok := batches[key]
+			if !ok {
+				batch = &pendingBatch{deadline: time.Now().Add(c.cfg.Batch.Timeout)}
+				batches[key] = batch
+			}
+			batch.msgs = append(batch.msgs, msg)
+			if len(batch.msgs) < c.cfg.Batch.Size {
+				continue
+			}
+			delete(batches, key)
+			if err := c.processBatch(ctx, reader, batch.msgs); err != nil {
+				return err
+			}
+		case <-timer.C:
+			now := time.Now()
+			for key, batch := range batches {
+				if batch.deadline.After(now) {
+					continue
+				}
+				delete(batches, key)
+				if err := c.processBatch(ctx, reader, batch.msgs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func nextDeadline(batches map[partitionKey]*pendingBatch, timeout time.Duration) time.Time {
+	next := time.Now().Add(timeout)
+	for _, batch := range batches {
+		if batch.deadline.Before(next) {
+			next = batch.deadline
+		}
+	}
+	return next
+}
+
+func (c *Consumer) processBatch(ctx context.Context, reader Reader, msgs []kafka.Message) error {
+	handleCtx, cancel := c.handleContext(ctx)
+	defer cancel()
+
+	for len(msgs) > 0 {
+		err := c.handleBatch(handleCtx, msgs)
+		if err == nil {
+			return c.commit(handleCtx, reader, msgs[len(msgs)-1])
+		}
+		if interrupted(handleCtx, err) {
+			c.logger.Infow("batch left uncommitted after shutdown timeout", "messages", len(msgs), "error", err)
+			return nil
+		}
+
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || batchErr.Index < 0 || batchErr.Index >= len(msgs) {
+			for _, msg := range msgs {
+				if err := c.process(ctx, reader, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if batchErr.Index > 0 {
+			if err := c.commit(handleCtx, reader, msgs[batchErr.Index-1]); err != nil {
+				return err
+			}
+		}
+		if err := c.process(ctx, reader, msgs[batchErr.Index]); err != nil {
+			return err
+		}
+		msgs = msgs[batchErr.Index+1:]
+	}
+	return nil
+}
+
+// handleBatch calls the batch handler once, every message is recorded with
+// an equal share of the batch latency
+func (c *Consumer) handleBatch(ctx context.Context, msgs []kafka.Message) error {
+	start := time.Now()
+	err := c.batchHandler.HandleBatch(ctx, msgs)
+	latency := time.Since(start) / time.Duration(len(msgs))
+
+	var batchErr *BatchError
+	failed := -1
+	if errors.As(err, &batchErr) {
+		failed = batchErr.Index
+	}
+	for i, msg := range msgs {
+		var msgErr error
+		if err != nil && (failed < 0 || i == failed) {
+			msgErr = err
+		}
+		c.stats.handled(msg, latency, msgErr)
+		if c.metrics != nil {
+			c.metrics.MessageHandled(msg.Topic, msg.Partition, latency, msgErr)
+		}
+		if failed >= 0 && i == failed {
+			break
+		}
+	}
+	return err
+}
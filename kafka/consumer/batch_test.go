@@ -0,0 +1,165 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/segmentio/kafka-go"
+)
+
+// batchRecorder fails a batch at the poison message, with a *BatchError when
+// partial is set, and records every batch it gets
+type batchRecorder struct {
+	partial bool
+
+	mu      sync.Mutex
+	batches []string
+}
+
+func (r *batchRecorder) HandleBatch(_ context.Context, msgs []kafka.Message) error {
+	values := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		values = append(values, string(msg.Value))
+	}
+	r.mu.Lock()
+	r.batches = append(r.batches, strings.Join(values, " "))
+	r.mu.Unlock()
+
+	for i, value := range values {
+		if value != "poison" {
+			continue
+		}
+		if r.partial {
+			return &consumer.BatchError{Index: i, Err: errPoison}
+		}
+		return errPoison
+	}
+	return nil
+}
+
+func (r *batchRecorder) handled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.batches...)
+}
+
+func TestBatchConsumerFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		partial       bool
+		policy        consumer.FailurePolicy
+		wantBatches   []string
+		wantErr       error
+		wantCommitted int64
+	}{
+		{
+			name:          "batch error commits the prefix and handles the rest as a new batch",
+			partial:       true,
+			wantBatches:   []string{"a b poison c d", "poison", "c d"},
+			wantCommitted: 5,
+		},
+		{
+			name:          "batch error with stop commits only the prefix",
+			partial:       true,
+			policy:        consumer.FailureStop,
+			wantBatches:   []string{"a b poison c d", "poison"},
+			wantErr:       consumer.ErrHandleMessage,
+			wantCommitted: 2,
+		},
+		{
+			name:          "other error handles every message alone",
+			wantBatches:   []string{"a b poison c d", "a", "b", "poison", "c", "d"},
+			wantCommitted: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			produce(t, broker, testTopic, "a", "b", "poison", "c", "d")
+
+			handler := &batchRecorder{partial: tt.partial}
+			cfg := testConfig()
+			cfg.Batch = consumer.BatchConfig{Size: 5, Timeout: time.Hour}
+			cfg.Retry.OnFailure = tt.policy
+			c, err := consumer.NewBatchConsumer(cfg, handler, consumer.WithReader(broker.Reader(testGroup, testTopic)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			last := tt.wantBatches[len(tt.wantBatches)-1]
+			waitFor(t, last, func() bool {
+				batches := handler.handled()
+				return len(batches) == len(tt.wantBatches) && batches[len(batches)-1] == last
+			})
+			if tt.wantErr != nil {
+				select {
+				case err = <-done:
+				case <-time.After(2 * time.Second):
+					t.Fatal("Run didn't return")
+				}
+				cancel()
+			} else {
+				err = stop(t, cancel, done)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run = %v, want %v", err, tt.wantErr)
+			}
+			if got := handler.handled(); fmt.Sprint(got) != fmt.Sprint(tt.wantBatches) {
+				t.Errorf("batches = %q, want %q", got, tt.wantBatches)
+			}
+			if got := broker.Committed(testGroup, testTopic, 0); got != tt.wantCommitted {
+				t.Errorf("committed = %d, want %d", got, tt.wantCommitted)
+			}
+		})
+	}
+}
+
+func TestBatchConsumerFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		batch       consumer.BatchConfig
+		wantBatches []string
+	}{
+		{
+			name:        "full batches",
+			batch:       consumer.BatchConfig{Size: 2, Timeout: time.Hour},
+			wantBatches: []string{"a b", "c d"},
+		},
+		{
+			name:        "partial batch after timeout",
+			batch:       consumer.BatchConfig{Size: 10, Timeout: 50 * time.Millisecond},
+			wantBatches: []string{"a b c d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			produce(t, broker, testTopic, "a", "b", "c", "d")
+
+			handler := &batchRecorder{}
+			cfg := testConfig()
+			cfg.Batch = tt.batch
+			cfg.CommitInterval = -1
+			c, err := consumer.NewBatchConsumer(cfg, handler, consumer.WithReader(broker.Reader(testGroup, testTopic)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			defer stop(t, cancel, done)
+			waitFor(t, "batches committed", func() bool { return broker.Committed(testGroup, testTopic, 0) == 4 })
+			if got := handler.handled(); fmt.Sprint(got) != fmt.Sprint(tt.wantBatches) {
+				t.Errorf("batches = %q, want %q", got, tt.wantBatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+// intervalCommitter keeps the last handled message of every partition, they
+// are committed together by flush instead of one broker round trip per message
+type intervalCommitter struct {
+	Reader
+
+	mu      sync.Mutex
+	pending map[partitionKey]kafka.Message
+}
+
+func newIntervalCommitter(reader Reader) *intervalCommitter {
+	return &intervalCommitter{
+		Reader:  reader,
+		pending: make(map[partitionKey]kafka.Message),
+	}
+}
+
+// mark replaces the pending message of the partition with a later one
+func (ic *intervalCommitter) mark(msgs ...kafka.Message) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	for _, msg := range msgs {
+		key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+		if pending, ok := ic.pending[key]; !ok || msg.Offset > pending.Offset {
+			ic.pending[key] = msg
+		}
+	}
+}
+
+// take returns pending messages and forgets them, mark them again when the commit fails
+func (ic *intervalCommitter) take() []kafka.Message {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	msgs := make([]kafka.Message, 0, len(ic.pending))
+	for key, msg := range ic.pending {
+		msgs = append(msgs, msg)
+		delete(ic.pending, key)
+	}
+	return msgs
+}
+
+// flush commits pending messages, failed ones stay pending for the next flush
+func (c *Consumer) flush(ctx context.Context, ic *intervalCommitter) error {
+	msgs := ic.take()
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := c.commitNow(ctx, ic.Reader, msgs...); err != nil {
+		ic.mark(msgs...)
+		return err
+	}
+	return nil
+}
+
+// flushLoop commits every CommitInterval until stop is closed, errors are
+// retried by the next flush and reported by Ready through the commit stats
+func (c *Consumer) flushLoop(ctx context.Context, ic *intervalCommitter, stop <-chan struct{}) {
+	ticker := time.NewTicker(c.cfg.CommitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.flush(ctx, ic); err != nil {
+				c.logger.Errorw("error committing offsets", "groupID", c.cfg.GroupID, "error", err)
+			}
+		}
+	}
+}
@@ -1,23 +1,382 @@
 package consumer
 
-import "github.com/segmentio/kafka-go"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/sync/errgroup"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+const (
+	OffsetResetEarliest = "earliest"
+	OffsetResetLatest   = "latest"
+
+	defaultWorkers         = 1
+	defaultQueueSize       = 100
+	defaultShutdownTimeout = 10 * time.Second
+	defaultCommitInterval  = time.Second
+	commitTimeout          = 10 * time.Second
+)
 
 type Config struct {
 	Brokers []string
+	GroupID string
+	Topics  []string
+	// OffsetReset is used when the group has no committed offset: earliest (default) or latest
+	OffsetReset string
+	MinBytes    int
+	MaxBytes    int
+	MaxWait     time.Duration
+
+	// Workers handle partitions in parallel, one partition is always handled by the same worker
+	Workers   int
+	QueueSize int
+	// ShutdownTimeout is how long in-flight messages may take after ctx is canceled
+	ShutdownTimeout time.Duration
+	// CommitInterval is how often the last handled offset of every partition is
+	// committed, default 1s. Messages handled since the last commit are delivered
+	// again after a crash. A negative value commits every message synchronously.
+	CommitInterval time.Duration
+
+	// Batch is used by NewBatchConsumer only
+	Batch  BatchConfig
+	Retry  RetryConfig
+	Health HealthConfig
 }
 
-func NewConsumer(config Config) (r *kafka.Reader, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
+type Consumer struct {
+	cfg           Config
+	reader        Reader
+	readerFactory ReaderFactory
+	tierReaders   []Reader
+	writer        producer.Writer
+	handler       Handler
+	batchHandler  BatchHandler
+	middlewares   []Middleware
+	logger        Logger
+	metrics       Metrics
+	stats         *statsTracker
+}
+
+func NewConsumer(config Config, handler Handler, opts ...OptionFunc) (*Consumer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultQueueSize
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if config.CommitInterval == 0 {
+		config.CommitInterval = defaultCommitInterval
+	}
+	if config.Health.PartitionTTL <= 0 {
+		config.Health.PartitionTTL = defaultPartitionTTL
+	}
+
+	c := &Consumer{
+		cfg:     config,
+		handler: handler,
+		logger:  log.Default(),
+		stats:   newStatsTracker(config.Health.PartitionTTL),
+	}
+	c.With(opts...)
+	c.handler = Chain(c.middlewares...)(c.handler)
+
+	if c.readerFactory == nil {
+		c.readerFactory = kafkaReaderFactory(config)
+	}
+	if c.reader == nil {
+		c.reader = c.readerFactory(config.GroupID, config.Topics)
+	}
+	for _, tier := range config.Retry.Tiers {
+		// every tier has its own group, waiting for a delay must not block other topics
+		groupID := fmt.Sprintf("%s.%s", config.GroupID, tier.Suffix)
+		c.tierReaders = append(c.tierReaders, c.readerFactory(groupID, tierTopics(config.Topics, tier)))
+	}
+	if c.writer == nil && config.Retry.forwards() {
+		writer, err := producer.NewProducer(producer.Config{Brokers: config.Brokers})
+		if err != nil {
+			return nil, err
 		}
+		c.writer = writer
+	}
+
+	return c, nil
+}
+
+func kafkaReaderFactory(config Config) ReaderFactory {
+	startOffset := kafka.FirstOffset
+	if config.OffsetReset == OffsetResetLatest {
+		startOffset = kafka.LastOffset
+	}
+	return func(groupID string, topics []string) Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     config.Brokers,
+			GroupID:     groupID,
+			GroupTopics: topics,
+			MinBytes:    config.MinBytes,
+			MaxBytes:    config.MaxBytes,
+			MaxWait:     config.MaxWait,
+			StartOffset: startOffset,
+			// offsets are committed explicitly after handling
+			CommitInterval: 0,
+		})
+	}
+}
+
+func (cfg Config) validate() error {
+	if len(cfg.Brokers) == 0 {
+		return ErrEmptyBrokers
+	}
+	if cfg.GroupID == "" {
+		return ErrEmptyGroupID
+	}
+	if len(cfg.Topics) == 0 {
+		return ErrEmptyTopics
+	}
+	switch cfg.OffsetReset {
+	case "", OffsetResetEarliest, OffsetResetLatest:
+		return nil
+	default:
+		return ErrOffsetReset
+	}
+}
+
+// Run fetches messages until ctx is canceled, a commit or a forward fails, or a
+// handler fails with Retry.OnFailure set to FailureStop. Messages are committed
+// after successful handling, after they are forwarded by the Retry policy or
+// after they are skipped by OnFailure. A message whose handling is cut by
+// ShutdownTimeout is not committed. Readers and the retry producer are closed when Run returns.
+func (c *Consumer) Run(ctx context.Context) error {
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+	for _, reader := range append([]Reader{c.reader}, c.tierReaders...) {
+		errGroup.Go(func() error {
+			return c.consume(groupCtx, reader)
+		})
+	}
+
+	err := errGroup.Wait()
+	c.logger.Infow("consumer stopped", "groupID", c.cfg.GroupID, "topics", c.cfg.Topics, "error", err)
+	return errors.Join(err, c.close())
+}
+
+func (c *Consumer) close() error {
+	var err error
+	for _, reader := range append([]Reader{c.reader}, c.tierReaders...) {
+		if closeErr := reader.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr, ErrCloseReader)
+		}
+	}
+	if c.writer != nil {
+		err = errors.Join(err, c.writer.Close())
+	}
+	return err
+}
+
+func (c *Consumer) consume(ctx context.Context, reader Reader) error {
+	if c.cfg.CommitInterval < 0 {
+		return c.consumeWith(ctx, reader)
+	}
+
+	committer := newIntervalCommitter(reader)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		c.flushLoop(context.WithoutCancel(ctx), committer, stop)
 	}()
-	//reader := kafka.NewReader(kafka.ReaderConfig{
-	//	Brokers: config.Brokers,
-	//	GroupID: "group-id",
-	//	Topic:   "topic",
-	//})
-
-	//return reader, err
-	return nil, nil
+
+	err := c.consumeWith(ctx, committer)
+	close(stop)
+	<-stopped
+	// handled messages are committed even when ctx is canceled
+	return errors.Join(err, c.flush(context.WithoutCancel(ctx), committer))
+}
+
+func (c *Consumer) consumeWith(ctx context.Context, reader Reader) error {
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+
+	queues := make([]chan kafka.Message, c.cfg.Workers)
+	for i := range queues {
+		queue := make(chan kafka.Message, c.cfg.QueueSize)
+		queues[i] = queue
+		errGroup.Go(func() error {
+			if c.batchHandler != nil {
+				return c.workBatch(groupCtx, reader, queue)
+			}
+			return c.work(groupCtx, reader, queue)
+		})
+	}
+	errGroup.Go(func() error {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		return c.fetch(groupCtx, reader, queues)
+	})
+
+	return errGroup.Wait()
+}
+
+func (c *Consumer) fetch(ctx context.Context, reader Reader, queues []chan kafka.Message) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Join(err, ErrFetchMessage)
+		}
+		c.stats.fetched(msg)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case queues[partitionIndex(msg, len(queues))] <- msg:
+		}
+	}
+}
+
+func (c *Consumer) work(ctx context.Context, reader Reader, queue <-chan kafka.Message) error {
+	for msg := range queue {
+		// queued messages are not committed, they will be fetched again
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := waitRetry(ctx, msg); err != nil {
+			return nil
+		}
+		if err := c.process(ctx, reader, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleContext lets in-flight messages finish during ShutdownTimeout after ctx is canceled
+func (c *Consumer) handleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	handleCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(c.cfg.ShutdownTimeout, cancel)
+	})
+	return handleCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// interrupted reports a handle error while ShutdownTimeout has canceled the
+// handle ctx, such a message is neither skipped nor forwarded but fetched
+// again after restart
+func interrupted(handleCtx context.Context, err error) bool {
+	return err != nil && handleCtx.Err() != nil
+}
+
+func (c *Consumer) process(ctx context.Context, reader Reader, msg kafka.Message) error {
+	handleCtx, cancel := c.handleContext(ctx)
+	defer cancel()
+
+	attempts, err := c.handleWithRetry(handleCtx, msg)
+	switch {
+	case err == nil:
+	case interrupted(handleCtx, err):
+		c.logger.Infow(
+			"message left uncommitted after shutdown timeout",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"error", err,
+		)
+		return nil
+	case c.cfg.Retry.forwards():
+		if err := c.forward(handleCtx, msg, attempts, err); err != nil {
+			return err
+		}
+	case c.cfg.Retry.OnFailure == FailureStop:
+		return errors.Join(log.Wrap("handle message", err, messageFields(msg)), ErrHandleMessage)
+	default:
+		c.logger.Errorw(
+			"message skipped after handle error",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"attempt", attempts,
+			"error", err,
+		)
+	}
+
+	return c.commit(handleCtx, reader, msg)
+}
+
+// handle calls the handler once and records its latency
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) error {
+	start := time.Now()
+	err := c.handler.Handle(ctx, msg)
+	latency := time.Since(start)
+
+	c.stats.handled(msg, latency, err)
+	if c.metrics != nil {
+		c.metrics.MessageHandled(msg.Topic, msg.Partition, latency, err)
+	}
+	return err
+}
+
+// commit hands messages to the interval committer, or commits them at once
+// when CommitInterval is negative
+func (c *Consumer) commit(ctx context.Context, reader Reader, msgs ...kafka.Message) error {
+	if committer, ok := reader.(*intervalCommitter); ok {
+		committer.mark(msgs...)
+		return nil
+	}
+	return c.commitNow(ctx, reader, msgs...)
+}
+
+func (c *Consumer) commitNow(ctx context.Context, reader Reader, msgs ...kafka.Message) error {
+	commitCtx, cancel := context.WithTimeout(ctx, commitTimeout)
+	defer cancel()
+
+	if err := reader.CommitMessages(commitCtx, msgs...); err != nil {
+		c.stats.commitFailed()
+		if c.metrics != nil {
+			for _, msg := range msgs {
+				c.metrics.CommitFailed(msg.Topic, msg.Partition, err)
+			}
+		}
+		return errors.Join(err, ErrCommitMessage)
+	}
+
+	for _, msg := range msgs {
+		lag := c.stats.committed(msg)
+		if c.metrics != nil {
+			c.metrics.MessageCommitted(msg.Topic, msg.Partition, msg.Offset, lag)
+		}
+	}
+	return nil
+}
+
+func messageFields(msg kafka.Message) log.Fld {
+	return log.Fld{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	}
+}
+
+func partitionIndex(msg kafka.Message, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(msg.Topic))
+	_, _ = h.Write([]byte(strconv.Itoa(msg.Partition)))
+	return int(h.Sum32() % uint32(n))
 }
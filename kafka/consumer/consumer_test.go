@@ -0,0 +1,338 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	testTopic = "orders"
+	testGroup = "orders-service"
+)
+
+var errPoison = errors.New("poison message")
+
+func testConfig() consumer.Config {
+	return consumer.Config{
+		Brokers: []string{"kafkatest"},
+		GroupID: testGroup,
+		Topics:  []string{testTopic},
+	}
+}
+
+func produce(t *testing.T, broker *kafkatest.Broker, topic string, values ...string) {
+	t.Helper()
+	msgs := make([]kafka.Message, 0, len(values))
+	for _, v := range values {
+		msgs = append(msgs, kafka.Message{Value: []byte(v)})
+	}
+	if err := broker.Writer(topic).WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recorder is a handler failing on values in fail, it records every call
+type recorder struct {
+	fail map[string]bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) Handle(_ context.Context, msg kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, string(msg.Value))
+	if r.fail[string(msg.Value)] {
+		return errPoison
+	}
+	return nil
+}
+
+func (r *recorder) handled(value string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, call := range r.calls {
+		if call == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recorder) count(value string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, call := range r.calls {
+		if call == value {
+			n++
+		}
+	}
+	return n
+}
+
+// countingReader counts CommitMessages calls of the wrapped reader
+type countingReader struct {
+	consumer.Reader
+	commits atomic.Int64
+}
+
+func (r *countingReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.commits.Add(1)
+	return r.Reader.CommitMessages(ctx, msgs...)
+}
+
+func run(c *consumer.Consumer) (context.CancelFunc, <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	return cancel, done
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func stop(t *testing.T, cancel context.CancelFunc, done <-chan error) error {
+	t.Helper()
+	cancel()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't return")
+		return nil
+	}
+}
+
+func TestConsumerFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        consumer.FailurePolicy
+		wantErr       error
+		wantHandled   []string
+		wantCommitted int64
+	}{
+		{
+			name:          "skip commits the failed message",
+			policy:        consumer.FailureSkip,
+			wantHandled:   []string{"a", "poison", "b"},
+			wantCommitted: 3,
+		},
+		{
+			name:          "stop returns the error",
+			policy:        consumer.FailureStop,
+			wantErr:       consumer.ErrHandleMessage,
+			wantHandled:   []string{"a", "poison"},
+			wantCommitted: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			produce(t, broker, testTopic, "a", "poison", "b")
+
+			handler := &recorder{fail: map[string]bool{"poison": true}}
+			cfg := testConfig()
+			cfg.Retry.OnFailure = tt.policy
+			c, err := consumer.NewConsumer(cfg, handler, consumer.WithReader(broker.Reader(testGroup, testTopic)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			last := tt.wantHandled[len(tt.wantHandled)-1]
+			waitFor(t, last, func() bool { return handler.handled(last) })
+			if tt.wantErr != nil {
+				select {
+				case err = <-done:
+				case <-time.After(2 * time.Second):
+					t.Fatal("Run didn't return")
+				}
+				cancel()
+			} else {
+				err = stop(t, cancel, done)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run = %v, want %v", err, tt.wantErr)
+			}
+			if handler.handled("b") != (tt.policy == consumer.FailureSkip) {
+				t.Errorf("calls = %v", handler.calls)
+			}
+			if got := broker.Committed(testGroup, testTopic, 0); got != tt.wantCommitted {
+				t.Errorf("committed = %d, want %d", got, tt.wantCommitted)
+			}
+		})
+	}
+}
+
+func TestConsumerShutdownTimeoutLeavesMessageUncommitted(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{name: "interval commits"},
+		{name: "synchronous commits", interval: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			produce(t, broker, testTopic, "a", "slow")
+
+			started := make(chan struct{})
+			handler := consumer.HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+				if string(msg.Value) != "slow" {
+					return nil
+				}
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			cfg := testConfig()
+			cfg.CommitInterval = tt.interval
+			cfg.ShutdownTimeout = 20 * time.Millisecond
+			c, err := consumer.NewConsumer(cfg, handler, consumer.WithReader(broker.Reader(testGroup, testTopic)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			select {
+			case <-started:
+			case <-time.After(2 * time.Second):
+				t.Fatal("slow message not handled")
+			}
+			if err := stop(t, cancel, done); err != nil {
+				t.Fatalf("Run = %v", err)
+			}
+
+			// the default FailureSkip doesn't skip a message cut by the shutdown
+			if got := broker.Committed(testGroup, testTopic, 0); got != 1 {
+				t.Errorf("committed = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestConsumerCommitInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		wantCommits int64
+	}{
+		{name: "interval commits once on shutdown", interval: time.Hour, wantCommits: 1},
+		{name: "negative interval commits every message", interval: -1, wantCommits: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			values := make([]string, 20)
+			for i := range values {
+				values[i] = strconv.Itoa(i)
+			}
+			produce(t, broker, testTopic, values...)
+
+			handler := &recorder{}
+			reader := &countingReader{Reader: broker.Reader(testGroup, testTopic)}
+			cfg := testConfig()
+			cfg.CommitInterval = tt.interval
+			c, err := consumer.NewConsumer(cfg, handler, consumer.WithReader(reader))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			waitFor(t, "last message", func() bool { return handler.handled("19") })
+			if err := stop(t, cancel, done); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := reader.commits.Load(); got != tt.wantCommits {
+				t.Errorf("commit calls = %d, want %d", got, tt.wantCommits)
+			}
+			if got := broker.Committed(testGroup, testTopic, 0); got != 20 {
+				t.Errorf("committed = %d, want 20", got)
+			}
+		})
+	}
+}
+
+func TestConsumerCommitsOnTick(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	produce(t, broker, testTopic, "a", "b")
+
+	cfg := testConfig()
+	cfg.CommitInterval = 10 * time.Millisecond
+	c, err := consumer.NewConsumer(cfg, &recorder{}, consumer.WithReader(broker.Reader(testGroup, testTopic)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel, done := run(c)
+	defer stop(t, cancel, done)
+	waitFor(t, "commit", func() bool { return broker.Committed(testGroup, testTopic, 0) == 2 })
+}
+
+func TestConsumerRetryTiersAndDLQ(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	produce(t, broker, testTopic, "ok", "poison")
+
+	handler := &recorder{fail: map[string]bool{"poison": true}}
+	cfg := testConfig()
+	cfg.Retry = consumer.RetryConfig{
+		Attempts:  1,
+		Backoff:   time.Millisecond,
+		Tiers:     []consumer.RetryTier{{Suffix: "retry", Delay: 10 * time.Millisecond}},
+		DLQSuffix: "dlq",
+	}
+	c, err := consumer.NewConsumer(cfg, handler,
+		consumer.WithReaderFactory(broker.ReaderFactory()),
+		consumer.WithRetryWriter(broker.Writer("")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel, done := run(c)
+	dlq := broker.ExpectMessage(t, testTopic+".dlq", func(kafka.Message) bool { return true })
+	if err := stop(t, cancel, done); err != nil {
+		t.Fatal(err)
+	}
+
+	// two attempts in the main topic, two in the retry tier
+	if got := handler.count("poison"); got != 4 {
+		t.Errorf("poison handled %d times, want 4", got)
+	}
+	if v, _ := consumer.Header(dlq, consumer.HeaderAttempt); v != "4" {
+		t.Errorf("%s = %q, want 4", consumer.HeaderAttempt, v)
+	}
+	if v, _ := consumer.Header(dlq, consumer.HeaderOriginalTopic); v != testTopic {
+		t.Errorf("%s = %q, want %s", consumer.HeaderOriginalTopic, v, testTopic)
+	}
+	if got := broker.Committed(testGroup, testTopic, 0); got != 2 {
+		t.Errorf("committed = %d, want 2", got)
+	}
+	if got := broker.Committed(testGroup+".retry", testTopic+".retry", 0); got != 1 {
+		t.Errorf("retry tier committed = %d, want 1", got)
+	}
+}
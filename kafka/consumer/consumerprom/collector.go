@@ -0,0 +1,92 @@
+// Package consumerprom exports consumer.Stats as Prometheus metrics
+package consumerprom
+
+import (
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+const namespace = "kafka_consumer"
+
+// StatsSource is implemented by *consumer.Consumer
+type StatsSource interface {
+	Stats() consumer.Stats
+}
+
+// Collector reads a Stats snapshot on every scrape, so the consumer hot path
+// doesn't depend on Prometheus.
+type Collector struct {
+	source StatsSource
+	group  string
+
+	lag            *prometheus.Desc
+	offset         *prometheus.Desc
+	highWaterMark  *prometheus.Desc
+	messages       *prometheus.Desc
+	handleErrors   *prometheus.Desc
+	throughput     *prometheus.Desc
+	latency        *prometheus.Desc
+	latencyMax     *prometheus.Desc
+	commitErrors   *prometheus.Desc
+	commitFailures *prometheus.Desc
+}
+
+func NewCollector(source StatsSource, group string) *Collector {
+	labels := []string{"group", "topic", "partition"}
+	return &Collector{
+		source: source,
+		group:  group,
+
+		lag: prometheus.NewDesc(namespace+"_lag",
+			"Messages between the committed offset and the high water mark.", labels, nil),
+		offset: prometheus.NewDesc(namespace+"_committed_offset",
+			"Last committed offset.", labels, nil),
+		highWaterMark: prometheus.NewDesc(namespace+"_high_water_mark",
+			"Last seen partition high water mark.", labels, nil),
+		messages: prometheus.NewDesc(namespace+"_messages_total",
+			"Handler calls, retries included.", labels, nil),
+		handleErrors: prometheus.NewDesc(namespace+"_handle_errors_total",
+			"Handler calls returned an error.", labels, nil),
+		throughput: prometheus.NewDesc(namespace+"_throughput",
+			"Handled messages per second averaged over the last minute.", labels, nil),
+		latency: prometheus.NewDesc(namespace+"_handler_latency_seconds",
+			"Handler latency.", labels, nil),
+		latencyMax: prometheus.NewDesc(namespace+"_handler_latency_max_seconds",
+			"Highest handler latency.", labels, nil),
+		commitErrors: prometheus.NewDesc(namespace+"_commit_errors_total",
+			"Failed offset commits.", []string{"group"}, nil),
+		commitFailures: prometheus.NewDesc(namespace+"_consecutive_commit_errors",
+			"Failed offset commits since the last successful one.", []string{"group"}, nil),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lag
+	ch <- c.offset
+	ch <- c.highWaterMark
+	ch <- c.messages
+	ch <- c.handleErrors
+	ch <- c.throughput
+	ch <- c.latency
+	ch <- c.latencyMax
+	ch <- c.commitErrors
+	ch <- c.commitFailures
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.source.Stats()
+	for _, p := range stats.Partitions {
+		labels := []string{c.group, p.Topic, strconv.Itoa(p.Partition)}
+		ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, float64(p.Lag), labels...)
+		ch <- prometheus.MustNewConstMetric(c.offset, prometheus.GaugeValue, float64(p.Offset), labels...)
+		ch <- prometheus.MustNewConstMetric(c.highWaterMark, prometheus.GaugeValue, float64(p.HighWaterMark), labels...)
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(p.Messages), labels...)
+		ch <- prometheus.MustNewConstMetric(c.handleErrors, prometheus.CounterValue, float64(p.HandleErrors), labels...)
+		ch <- prometheus.MustNewConstMetric(c.throughput, prometheus.GaugeValue, p.Throughput, labels...)
+		ch <- prometheus.MustNewConstSummary(c.latency, uint64(p.Messages), p.LatencySum.Seconds(), nil, labels...)
+		ch <- prometheus.MustNewConstMetric(c.latencyMax, prometheus.GaugeValue, p.LatencyMax.Seconds(), labels...)
+	}
+	ch <- prometheus.MustNewConstMetric(c.commitErrors, prometheus.CounterValue, float64(stats.CommitErrors), c.group)
+	ch <- prometheus.MustNewConstMetric(c.commitFailures, prometheus.GaugeValue, float64(stats.ConsecutiveCommitErrors), c.group)
+}
@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupCapacity = 100_000
+	defaultDedupLease    = time.Minute
+	maxDedupPoll         = time.Second
+)
+
+// DedupStore remembers ids of handled messages. An id is leased while its
+// message is handled and recorded as done after the handler succeeds.
+type DedupStore interface {
+	// Acquire leases id for ttl. It returns false when id is done and
+	// ErrDedupInProgress while another lease of id hasn't expired.
+	Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Done records the leased id as handled for ttl
+	Done(ctx context.Context, id string, ttl time.Duration) error
+	// Release drops the lease, so the message is handled again on redelivery
+	Release(ctx context.Context, id string) error
+}
+
+// DedupKeyFunc returns the message id, messages with an empty id are not deduplicated
+type DedupKeyFunc func(msg kafka.Message) string
+
+// DedupKey is the x-message-id header set by idempotent producers, otherwise
+// the topic, partition and offset, which catch redelivery of the same record only.
+func DedupKey(msg kafka.Message) string {
+	if id, ok := Header(msg, producer.HeaderMessageID); ok && id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// Dedup is DedupWithLease with a one minute lease
+func Dedup(store DedupStore, ttl time.Duration, key DedupKeyFunc) Middleware {
+	return DedupWithLease(store, defaultDedupLease, ttl, key)
+}
+
+// DedupWithLease skips messages whose id was handled within ttl. The id is
+// leased for lease before the handler runs, recorded as done for ttl after it
+// succeeds and released when it fails. A copy arriving while the lease is held
+// waits for it, so a crash in between delays the message by lease at most.
+// lease must be longer than the handler takes, otherwise copies run in parallel.
+//
+// Middlewares are not applied to HandleBatch of NewBatchConsumer, only to
+// messages handled alone after a batch failure.
+func DedupWithLease(store DedupStore, lease, ttl time.Duration, key DedupKeyFunc) Middleware {
+	if key == nil {
+		key = DedupKey
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+			id := key(msg)
+			if id == "" {
+				return next.Handle(ctx, msg)
+			}
+
+			acquired, err := acquireLease(ctx, store, id, lease)
+			if err != nil {
+				return errors.Join(err, ErrDedupStore)
+			}
+			if !acquired {
+				return nil
+			}
+
+			if err := next.Handle(ctx, msg); err != nil {
+				if releaseErr := store.Release(context.WithoutCancel(ctx), id); releaseErr != nil {
+					return errors.Join(err, releaseErr, ErrDedupStore)
+				}
+				return err
+			}
+			if err := store.Done(context.WithoutCancel(ctx), id, ttl); err != nil {
+				return errors.Join(err, ErrDedupStore)
+			}
+			return nil
+		})
+	}
+}
+
+// acquireLease waits while another handler holds the lease of id
+func acquireLease(ctx context.Context, store DedupStore, id string, lease time.Duration) (bool, error) {
+	poll := max(min(lease/10, maxDedupPoll), time.Millisecond)
+	for {
+		acquired, err := store.Acquire(ctx, id, lease)
+		if !errors.Is(err, ErrDedupInProgress) {
+			return acquired, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// MemoryDedupStore is an LRU of ids with expiry, it only deduplicates within one process
+type MemoryDedupStore struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+	done    bool
+}
+
+// NewMemoryDedupStore keeps at most capacity ids, the least recently acquired are evicted first
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = defaultDedupCapacity
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *MemoryDedupStore) Acquire(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := s.entries[id]; ok {
+		entry := el.Value.(*dedupEntry)
+		if entry.expires.After(now) {
+			if entry.done {
+				return false, nil
+			}
+			return false, ErrDedupInProgress
+		}
+		s.remove(el)
+	}
+
+	s.push(&dedupEntry{id: id, expires: now.Add(ttl)})
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Done(_ context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+	s.push(&dedupEntry{id: id, expires: time.Now().Add(ttl), done: true})
+	return nil
+}
+
+func (s *MemoryDedupStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+// push must be called with mu held
+func (s *MemoryDedupStore) push(entry *dedupEntry) {
+	s.entries[entry.id] = s.order.PushFront(entry)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+}
+
+// remove must be called with mu held
+func (s *MemoryDedupStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*dedupEntry).id)
+}
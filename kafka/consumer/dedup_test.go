@@ -0,0 +1,156 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		prepare func(s *consumer.MemoryDedupStore)
+		want    bool
+		wantErr error
+	}{
+		{
+			name:    "new id",
+			prepare: func(*consumer.MemoryDedupStore) {},
+			want:    true,
+		},
+		{
+			name: "lease held",
+			prepare: func(s *consumer.MemoryDedupStore) {
+				s.Acquire(ctx, "id", time.Minute)
+			},
+			wantErr: consumer.ErrDedupInProgress,
+		},
+		{
+			name: "done",
+			prepare: func(s *consumer.MemoryDedupStore) {
+				s.Acquire(ctx, "id", time.Minute)
+				s.Done(ctx, "id", time.Minute)
+			},
+			want: false,
+		},
+		{
+			name: "released",
+			prepare: func(s *consumer.MemoryDedupStore) {
+				s.Acquire(ctx, "id", time.Minute)
+				s.Release(ctx, "id")
+			},
+			want: true,
+		},
+		{
+			name: "lease expired",
+			prepare: func(s *consumer.MemoryDedupStore) {
+				s.Acquire(ctx, "id", time.Nanosecond)
+				time.Sleep(time.Millisecond)
+			},
+			want: true,
+		},
+		{
+			name: "done expired",
+			prepare: func(s *consumer.MemoryDedupStore) {
+				s.Acquire(ctx, "id", time.Minute)
+				s.Done(ctx, "id", time.Nanosecond)
+				time.Sleep(time.Millisecond)
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consumer.NewMemoryDedupStore(10)
+			tt.prepare(s)
+			got, err := s.Acquire(ctx, "id", time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Acquire error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Acquire = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func produceWithID(t *testing.T, broker *kafkatest.Broker, pairs ...string) {
+	t.Helper()
+	msgs := make([]kafka.Message, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		msgs = append(msgs, kafka.Message{
+			Value:   []byte(pairs[i+1]),
+			Headers: []kafka.Header{{Key: producer.HeaderMessageID, Value: []byte(pairs[i])}},
+		})
+	}
+	if err := broker.Writer(testTopic).WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumerDedup(t *testing.T) {
+	tests := []struct {
+		name string
+		fail map[string]bool
+		// held is leased by another consumer before Run, e.g. one that crashed
+		held string
+		want map[string]int
+	}{
+		{
+			name: "duplicates skipped",
+			want: map[string]int{"a": 1, "b": 1},
+		},
+		{
+			name: "failed message handled again by its copy",
+			fail: map[string]bool{"a": true},
+			want: map[string]int{"a": 2, "b": 1},
+		},
+		{
+			name: "expired lease of a crashed consumer doesn't lose the message",
+			held: "1",
+			want: map[string]int{"a": 1, "b": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			produceWithID(t, broker, "1", "a", "2", "b", "1", "a", "2", "b")
+
+			store := consumer.NewMemoryDedupStore(0)
+			lease := 50 * time.Millisecond
+			if tt.held != "" {
+				if ok, err := store.Acquire(context.Background(), tt.held, lease); !ok || err != nil {
+					t.Fatalf("Acquire = %v, %v", ok, err)
+				}
+			}
+
+			handler := &recorder{fail: tt.fail}
+			c, err := consumer.NewConsumer(testConfig(), handler,
+				consumer.WithReader(broker.Reader(testGroup, testTopic)),
+				consumer.WithMiddleware(consumer.DedupWithLease(store, lease, time.Minute, nil)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel, done := run(c)
+			waitFor(t, "all messages committed", func() bool { return broker.Committed(testGroup, testTopic, 0) == 4 })
+			if err := stop(t, cancel, done); err != nil {
+				t.Fatal(err)
+			}
+
+			for value, want := range tt.want {
+				if got := handler.count(value); got != want {
+					t.Errorf("%s handled %d times, want %d", value, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package consumer
+
+import "errors"
+
+var (
+	ErrEmptyBrokers    = errors.New("brokers are empty")
+	ErrEmptyGroupID    = errors.New("group id is empty")
+	ErrEmptyTopics     = errors.New("topics are empty")
+	ErrOffsetReset     = errors.New("unknown offset reset policy")
+	ErrFetchMessage    = errors.New("error fetch message")
+	ErrCommitMessage   = errors.New("error commit message")
+	ErrHandleMessage   = errors.New("error handle message")
+	ErrCloseReader     = errors.New("error close reader")
+	ErrForwardMessage  = errors.New("error forward message")
+	ErrLagExceeded     = errors.New("consumer lag exceeded")
+	ErrCommitErrors    = errors.New("consumer commit errors exceeded")
+	ErrDedupStore      = errors.New("error dedup store")
+	ErrDedupInProgress = errors.New("message is handled by another consumer")
+	ErrHandlerPanic    = errors.New("handler panic")
+)
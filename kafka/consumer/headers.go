@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempt           = "x-attempt"
+	HeaderRetryTier         = "x-retry-tier"
+	HeaderRetryNotBefore    = "x-retry-not-before"
+	HeaderFailedAt          = "x-failed-at"
+)
+
+// failureHeaders are removed when a message is replayed from the DLQ
+var failureHeaders = []string{
+	HeaderOriginalTopic,
+	HeaderOriginalPartition,
+	HeaderOriginalOffset,
+	HeaderError,
+	HeaderAttempt,
+	HeaderRetryTier,
+	HeaderRetryNotBefore,
+	HeaderFailedAt,
+}
+
+// Header returns the last value of the header key
+func Header(msg kafka.Message, key string) (string, bool) {
+	for i := len(msg.Headers) - 1; i >= 0; i-- {
+		if msg.Headers[i].Key == key {
+			return string(msg.Headers[i].Value), true
+		}
+	}
+	return "", false
+}
+
+// SetHeader returns headers with key replaced or appended, the input is not modified
+func SetHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	result := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if h.Key != key {
+			result = append(result, h)
+		}
+	}
+	return append(result, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func removeHeaders(headers []kafka.Header, keys ...string) []kafka.Header {
+	result := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		remove := false
+		for _, k := range keys {
+			if h.Key == k {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func intHeader(msg kafka.Message, key string, def int) int {
+	v, ok := Header(msg, key)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+func timeHeader(msg kafka.Message, key string) (time.Time, bool) {
+	v, ok := Header(msg, key)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+)
+
+type Logger interface {
+	Infow(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+type Handler interface {
+	Handle(ctx context.Context, msg kafka.Message) error
+}
+
+type HandlerFunc func(ctx context.Context, msg kafka.Message) error
+
+func (f HandlerFunc) Handle(ctx context.Context, msg kafka.Message) error {
+	return f(ctx, msg)
+}
+
+// Reader is the part of *kafka.Reader used by Consumer
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type ReaderFactory func(groupID string, topics []string) Reader
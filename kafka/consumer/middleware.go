@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/kafka/tracecontext"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// Middleware wraps a Handler, e.g. with Dedup
+type Middleware func(Handler) Handler
+
+// Chain runs middlewares in order, the first one is the outermost
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// Recovery turns a handler panic into ErrHandlerPanic, so the message goes
+// through the Retry policy instead of crashing the service
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.LogPanic(r)
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// ContextLogging puts the x-request-id header and the message position into
+// the log fields of ctx, loggers from log.FromContext(ctx) write them
+func ContextLogging() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+			ctx = log.ContextWithFields(ctx, messageFields(msg))
+			if requestID, ok := Header(msg, producer.HeaderRequestID); ok && requestID != "" {
+				ctx = log.ContextWithRequestID(ctx, requestID)
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// Timeout limits a single handler call, every retry attempt gets its own timeout
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// Instrument reports every handler call to metrics. Consumer does it already
+// with WithMetrics, this is for handlers used outside of it or for the latency
+// of inner middlewares only.
+func Instrument(metrics Metrics) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+			start := time.Now()
+			err := next.Handle(ctx, msg)
+			metrics.MessageHandled(msg.Topic, msg.Partition, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// TraceParent continues the W3C trace of the traceparent header in a new span
+// stored with tracecontext.ContextWith, a message without it starts a trace.
+// Trace and span ids are added to the log fields of ctx.
+func TraceParent() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg kafka.Message) error {
+			span := tracecontext.New()
+			if header, ok := Header(msg, tracecontext.HeaderTraceParent); ok {
+				if parent, err := tracecontext.Parse(header); err == nil {
+					span = parent.Child()
+					span.State, _ = Header(msg, tracecontext.HeaderTraceState)
+				}
+			}
+
+			ctx = tracecontext.ContextWith(ctx, span)
+			ctx = log.ContextWithFields(ctx, log.Fld{
+				tracecontext.TraceIDField: span.TraceIDString(),
+				tracecontext.SpanIDField:  span.SpanIDString(),
+			})
+			return next.Handle(ctx, msg)
+		})
+	}
+}
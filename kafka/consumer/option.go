@@ -0,0 +1,54 @@
+package consumer
+
+import "github.com/MikhailGulkin/packages/kafka/producer"
+
+type OptionFunc func(*Consumer)
+
+func (c *Consumer) With(opt ...OptionFunc) *Consumer {
+	for _, o := range opt {
+		o(c)
+	}
+	return c
+}
+
+func WithLogger(logger Logger) OptionFunc {
+	return func(c *Consumer) {
+		c.logger = logger
+	}
+}
+
+// WithReader replaces the kafka.Reader built from Config, e.g. with kafkatest
+func WithReader(reader Reader) OptionFunc {
+	return func(c *Consumer) {
+		c.reader = reader
+	}
+}
+
+// WithReaderFactory builds readers for retry tiers, and for the main topics when WithReader is not used
+func WithReaderFactory(factory ReaderFactory) OptionFunc {
+	return func(c *Consumer) {
+		c.readerFactory = factory
+	}
+}
+
+// WithRetryWriter replaces the producer used for retry topics and the DLQ
+func WithRetryWriter(writer producer.Writer) OptionFunc {
+	return func(c *Consumer) {
+		c.writer = writer
+	}
+}
+
+// WithMetrics sets a hook called on every handled and committed message
+func WithMetrics(metrics Metrics) OptionFunc {
+	return func(c *Consumer) {
+		c.metrics = metrics
+	}
+}
+
+// WithMiddleware wraps the handler, the first middleware is the outermost. With
+// NewBatchConsumer they wrap only the one message batches of the failure path.
+func WithMiddleware(middlewares ...Middleware) OptionFunc {
+	return func(c *Consumer) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const defaultReplayIdleTimeout = 5 * time.Second
+
+type ReplayConfig struct {
+	Brokers []string
+	GroupID string
+	// DLQTopic is read from the committed offset of GroupID
+	DLQTopic string
+	// Limit stops the replay after Limit messages, 0 means no limit
+	Limit int
+	// IdleTimeout stops the replay when the DLQ has no new messages for this long
+	IdleTimeout time.Duration
+}
+
+// Replayer moves DLQ messages back to their x-original-topic
+type Replayer struct {
+	reader Reader
+	writer producer.Writer
+	cfg    ReplayConfig
+}
+
+func NewReplayer(cfg ReplayConfig) (*Replayer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, ErrEmptyBrokers
+	}
+	if cfg.GroupID == "" {
+		return nil, ErrEmptyGroupID
+	}
+	if cfg.DLQTopic == "" {
+		return nil, ErrEmptyTopics
+	}
+	writer, err := producer.NewProducer(producer.Config{Brokers: cfg.Brokers})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayerWith(cfg, kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     cfg.GroupID,
+		Topic:       cfg.DLQTopic,
+		StartOffset: kafka.FirstOffset,
+	}), writer), nil
+}
+
+func NewReplayerWith(cfg ReplayConfig, reader Reader, writer producer.Writer) *Replayer {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultReplayIdleTimeout
+	}
+	return &Replayer{
+		reader: reader,
+		writer: writer,
+		cfg:    cfg,
+	}
+}
+
+// Replay republishes messages without failure headers and commits them in the DLQ,
+// it returns the number of replayed messages.
+func (r *Replayer) Replay(ctx context.Context) (int, error) {
+	replayed := 0
+	for r.cfg.Limit <= 0 || replayed < r.cfg.Limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, r.cfg.IdleTimeout)
+		msg, err := r.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				return replayed, nil
+			}
+			return replayed, errors.Join(err, ErrFetchMessage)
+		}
+
+		topic, ok := Header(msg, HeaderOriginalTopic)
+		if !ok {
+			return replayed, fmt.Errorf("message %s/%d/%d has no %s header", msg.Topic, msg.Partition, msg.Offset, HeaderOriginalTopic)
+		}
+		err = r.writer.WriteMessages(ctx, kafka.Message{
+			Topic:   topic,
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: removeHeaders(msg.Headers, failureHeaders...),
+		})
+		if err != nil {
+			return replayed, errors.Join(err, ErrForwardMessage)
+		}
+		if err := r.reader.CommitMessages(ctx, msg); err != nil {
+			return replayed, errors.Join(err, ErrCommitMessage)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (r *Replayer) Close() error {
+	return errors.Join(r.reader.Close(), r.writer.Close())
+}
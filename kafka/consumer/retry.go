@@ -0,0 +1,165 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// RetryTier is a retry topic named <topic>.<Suffix>, messages are handled again after Delay
+type RetryTier struct {
+	Suffix string
+	Delay  time.Duration
+}
+
+var DefaultRetryTiers = []RetryTier{
+	{Suffix: "retry.1m", Delay: time.Minute},
+	{Suffix: "retry.5m", Delay: 5 * time.Minute},
+}
+
+// FailurePolicy decides what happens to a failed message when there are no retry tiers and no DLQ
+type FailurePolicy int
+
+const (
+	// FailureSkip logs the error and commits the message, so one poison message
+	// doesn't stop every partition
+	FailureSkip FailurePolicy = iota
+	// FailureStop makes Run return the error, the message is fetched again after restart
+	FailureStop
+)
+
+// RetryConfig is the failure policy: Attempts in-process retries with exponential
+// backoff, then every tier in order, then the <topic>.<DLQSuffix> topic.
+// Without tiers and DLQ a failed message is handled by OnFailure.
+type RetryConfig struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Tiers      []RetryTier
+	DLQSuffix  string
+	OnFailure  FailurePolicy
+}
+
+func (cfg RetryConfig) forwards() bool {
+	return len(cfg.Tiers) > 0 || cfg.DLQSuffix != ""
+}
+
+func (cfg RetryConfig) backoff(attempt int) time.Duration {
+	backoff := cfg.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	backoff <<= attempt
+	if cfg.MaxBackoff > 0 && (backoff > cfg.MaxBackoff || backoff <= 0) {
+		backoff = cfg.MaxBackoff
+	}
+	return backoff
+}
+
+func tierTopics(topics []string, tier RetryTier) []string {
+	result := make([]string, 0, len(topics))
+	for _, t := range topics {
+		result = append(result, fmt.Sprintf("%s.%s", t, tier.Suffix))
+	}
+	return result
+}
+
+// handleWithRetry runs the handler up to Attempts+1 times
+func (c *Consumer) handleWithRetry(ctx context.Context, msg kafka.Message) (int, error) {
+	var err error
+	for attempt := 0; attempt <= c.cfg.Retry.Attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := sleep(ctx, c.cfg.Retry.backoff(attempt-1)); waitErr != nil {
+				return attempt, errors.Join(err, waitErr)
+			}
+		}
+		if err = c.handle(ctx, msg); err == nil {
+			return attempt + 1, nil
+		}
+	}
+	return c.cfg.Retry.Attempts + 1, err
+}
+
+// waitRetry delays messages of retry topics until their x-retry-not-before time
+func waitRetry(ctx context.Context, msg kafka.Message) error {
+	notBefore, ok := timeHeader(msg, HeaderRetryNotBefore)
+	if !ok {
+		return nil
+	}
+	return sleep(ctx, time.Until(notBefore))
+}
+
+// forward moves a failed message to the next retry tier or the DLQ
+func (c *Consumer) forward(ctx context.Context, msg kafka.Message, attempts int, handleErr error) error {
+	originalTopic, ok := Header(msg, HeaderOriginalTopic)
+	if !ok {
+		originalTopic = msg.Topic
+	}
+	nextTier := intHeader(msg, HeaderRetryTier, -1) + 1
+	totalAttempts := intHeader(msg, HeaderAttempt, 0) + attempts
+
+	headers := msg.Headers
+	if _, ok := Header(msg, HeaderOriginalTopic); !ok {
+		headers = SetHeader(headers, HeaderOriginalTopic, msg.Topic)
+		headers = SetHeader(headers, HeaderOriginalPartition, strconv.Itoa(msg.Partition))
+		headers = SetHeader(headers, HeaderOriginalOffset, strconv.FormatInt(msg.Offset, 10))
+	}
+	headers = SetHeader(headers, HeaderError, handleErr.Error())
+	headers = SetHeader(headers, HeaderAttempt, strconv.Itoa(totalAttempts))
+	headers = SetHeader(headers, HeaderFailedAt, strconv.FormatInt(time.Now().UnixMilli(), 10))
+
+	var topic string
+	switch {
+	case nextTier < len(c.cfg.Retry.Tiers):
+		tier := c.cfg.Retry.Tiers[nextTier]
+		topic = fmt.Sprintf("%s.%s", originalTopic, tier.Suffix)
+		headers = SetHeader(headers, HeaderRetryTier, strconv.Itoa(nextTier))
+		headers = SetHeader(headers, HeaderRetryNotBefore, strconv.FormatInt(time.Now().Add(tier.Delay).UnixMilli(), 10))
+	case c.cfg.Retry.DLQSuffix != "":
+		topic = fmt.Sprintf("%s.%s", originalTopic, c.cfg.Retry.DLQSuffix)
+		headers = removeHeaders(headers, HeaderRetryTier, HeaderRetryNotBefore)
+	default:
+		return errors.Join(log.Wrap("handle message", handleErr, messageFields(msg)), ErrHandleMessage)
+	}
+
+	err := c.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return errors.Join(log.Wrap("forward message", err, messageFields(msg)), ErrForwardMessage)
+	}
+
+	c.logger.Errorw(
+		"message forwarded after handle error",
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"to", topic,
+		"attempt", totalAttempts,
+		"error", handleErr,
+	)
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+// Package scylladedup is a consumer.DedupStore shared by all replicas, ids are
+// leased with lightweight transactions and expire with the row TTL.
+package scylladedup
+
+import (
+	"context"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/scylladb/gocqlx/v3"
+	"time"
+)
+
+const defaultTable = "kafka_dedup"
+
+type Store struct {
+	session *gocqlx.Session
+	table   string
+}
+
+// New uses the table kafka_dedup when table is empty, it may be prefixed with a keyspace
+func New(session *gocqlx.Session, table string) *Store {
+	if table == "" {
+		table = defaultTable
+	}
+	return &Store{
+		session: session,
+		table:   table,
+	}
+}
+
+// CreateTable creates the dedup table if it doesn't exist
+func (s *Store) CreateTable() error {
+	return s.session.ExecStmt(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id text PRIMARY KEY,
+		acquired_at timestamp,
+		done boolean
+	)`, s.table))
+}
+
+type dedupRow struct {
+	ID         string
+	AcquiredAt time.Time
+	Done       bool
+}
+
+// Acquire inserts a lease row, the existing row tells a done id from a held lease
+func (s *Store) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	var existing dedupRow
+	applied, err := s.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (id, acquired_at, done) VALUES (?, ?, false) IF NOT EXISTS USING TTL ?", s.table),
+		[]string{"id", "acquired_at", "ttl"},
+	).Bind(id, time.Now(), ttlSeconds(ttl)).GetCASRelease(&existing)
+	if err != nil || applied {
+		return applied, err
+	}
+	if !existing.Done {
+		return false, consumer.ErrDedupInProgress
+	}
+	return false, nil
+}
+
+// Done marks the lease row done with the new TTL, the row is inserted again
+// when the lease has already expired
+func (s *Store) Done(ctx context.Context, id string, ttl time.Duration) error {
+	applied, err := s.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("UPDATE %s USING TTL ? SET acquired_at = ?, done = true WHERE id = ? IF EXISTS", s.table),
+		[]string{"ttl", "acquired_at", "id"},
+	).Bind(ttlSeconds(ttl), time.Now(), id).ExecCASRelease()
+	if err != nil || applied {
+		return err
+	}
+	_, err = s.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (id, acquired_at, done) VALUES (?, ?, true) IF NOT EXISTS USING TTL ?", s.table),
+		[]string{"id", "acquired_at", "ttl"},
+	).Bind(id, time.Now(), ttlSeconds(ttl)).ExecCASRelease()
+	return err
+}
+
+// Release deletes with a transaction too, mixing LWT and plain writes on a row is unsafe
+func (s *Store) Release(ctx context.Context, id string) error {
+	_, err := s.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE id = ? IF EXISTS", s.table),
+		[]string{"id"},
+	).Bind(id).ExecCASRelease()
+	return err
+}
+
+func ttlSeconds(ttl time.Duration) int {
+	return int(max(ttl/time.Second, 1))
+}
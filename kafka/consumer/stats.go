@@ -0,0 +1,260 @@
+package consumer
+
+import (
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// throughputWindow is the time constant of the messages per second moving average
+	throughputWindow = time.Minute
+
+	defaultPartitionTTL = time.Minute
+)
+
+// Metrics is notified on every handled and committed message, e.g. to feed a
+// push based metrics system. Calls come from worker goroutines concurrently.
+type Metrics interface {
+	MessageHandled(topic string, partition int, latency time.Duration, err error)
+	MessageCommitted(topic string, partition int, offset, lag int64)
+	CommitFailed(topic string, partition int, err error)
+}
+
+// HealthConfig are the Ready thresholds, zero values disable the check
+type HealthConfig struct {
+	// MaxLag is the highest total lag of the main topics
+	MaxLag int64
+	// MaxCommitErrors is the number of commit failures in a row
+	MaxCommitErrors int
+	// PartitionTTL drops a partition from Stats when it wasn't fetched for that
+	// long while other partitions of its topic were, e.g. it was revoked by a
+	// rebalance. A consumer that fetches nothing at all keeps every partition.
+	// Default 1m.
+	PartitionTTL time.Duration
+}
+
+type Stats struct {
+	Partitions []PartitionStats
+	// Lag is the sum of partition lags
+	Lag          int64
+	Messages     int64
+	HandleErrors int64
+	CommitErrors int64
+	// ConsecutiveCommitErrors is reset by a successful commit
+	ConsecutiveCommitErrors int
+	// Throughput is handled messages per second averaged over the last minute
+	Throughput float64
+}
+
+type PartitionStats struct {
+	Topic     string
+	Partition int
+	// Offset is the last committed offset, -1 before the first commit.
+	// Lag is HighWaterMark-Offset-1, HighWaterMark is refreshed on every fetch.
+	Offset        int64
+	HighWaterMark int64
+	Lag           int64
+	Messages      int64
+	HandleErrors  int64
+	Throughput    float64
+	// LatencySum and Messages give the mean handler latency, retries included
+	LatencySum time.Duration
+	LatencyMax time.Duration
+	UpdatedAt  time.Time
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type partitionState struct {
+	PartitionStats
+	rate       float64
+	rateUpdate time.Time
+	fetchedAt  time.Time
+}
+
+type statsTracker struct {
+	mu                      sync.Mutex
+	partitions              map[partitionKey]*partitionState
+	lastFetch               map[string]time.Time
+	partitionTTL            time.Duration
+	commitErrors            int64
+	consecutiveCommitErrors int
+}
+
+func newStatsTracker(partitionTTL time.Duration) *statsTracker {
+	return &statsTracker{
+		partitions:   make(map[partitionKey]*partitionState),
+		lastFetch:    make(map[string]time.Time),
+		partitionTTL: partitionTTL,
+	}
+}
+
+// fetched keeps lag current while handlers are slow or stuck
+func (t *statsTracker) fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	p := t.partition(msg)
+	p.fetchedAt = now
+	t.lastFetch[msg.Topic] = now
+	p.HighWaterMark = max(p.HighWaterMark, msg.HighWaterMark)
+	if p.Offset < 0 {
+		// nothing committed by this consumer yet, the fetched message is the oldest pending one
+		p.Lag = max(p.HighWaterMark-msg.Offset, 0)
+		return
+	}
+	p.Lag = max(p.HighWaterMark-p.Offset-1, 0)
+}
+
+func (t *statsTracker) handled(msg kafka.Message, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	p := t.partition(msg)
+	p.Messages++
+	if err != nil {
+		p.HandleErrors++
+	}
+	p.LatencySum += latency
+	p.LatencyMax = max(p.LatencyMax, latency)
+	p.HighWaterMark = max(p.HighWaterMark, msg.HighWaterMark)
+	p.rate = decayRate(p.rate, p.rateUpdate, now) + 1/throughputWindow.Seconds()
+	p.rateUpdate = now
+	p.UpdatedAt = now
+}
+
+func (t *statsTracker) committed(msg kafka.Message) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.partition(msg)
+	p.Offset = msg.Offset
+	p.HighWaterMark = max(p.HighWaterMark, msg.HighWaterMark)
+	p.Lag = max(p.HighWaterMark-msg.Offset-1, 0)
+	p.UpdatedAt = time.Now()
+	t.consecutiveCommitErrors = 0
+	return p.Lag
+}
+
+func (t *statsTracker) commitFailed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.commitErrors++
+	t.consecutiveCommitErrors++
+}
+
+// partition must be called with mu held
+func (t *statsTracker) partition(msg kafka.Message) *partitionState {
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionState{
+			PartitionStats: PartitionStats{Topic: msg.Topic, Partition: msg.Partition, Offset: -1},
+			fetchedAt:      time.Now(),
+		}
+		t.partitions[key] = p
+	}
+	return p
+}
+
+// expire drops partitions no longer assigned to this consumer, kafka-go doesn't
+// report rebalances so a partition is revoked when its topic is fetched without it.
+// It must be called with mu held.
+func (t *statsTracker) expire() {
+	for key, p := range t.partitions {
+		if t.lastFetch[key.topic].Sub(p.fetchedAt) > t.partitionTTL {
+			delete(t.partitions, key)
+		}
+	}
+}
+
+func (t *statsTracker) snapshot() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire()
+	now := time.Now()
+	stats := Stats{
+		Partitions:              make([]PartitionStats, 0, len(t.partitions)),
+		CommitErrors:            t.commitErrors,
+		ConsecutiveCommitErrors: t.consecutiveCommitErrors,
+	}
+	for _, p := range t.partitions {
+		ps := p.PartitionStats
+		ps.Throughput = decayRate(p.rate, p.rateUpdate, now)
+		stats.Partitions = append(stats.Partitions, ps)
+		stats.Lag += ps.Lag
+		stats.Messages += ps.Messages
+		stats.HandleErrors += ps.HandleErrors
+		stats.Throughput += ps.Throughput
+	}
+	sort.Slice(stats.Partitions, func(i, j int) bool {
+		a, b := stats.Partitions[i], stats.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return stats
+}
+
+// decayRate is an exponentially weighted rate, each event adds 1/window
+func decayRate(rate float64, updated, now time.Time) float64 {
+	if updated.IsZero() {
+		return rate
+	}
+	return rate * math.Exp(-now.Sub(updated).Seconds()/throughputWindow.Seconds())
+}
+
+// Stats returns a snapshot of lag, throughput and handler latency per partition.
+// Partitions appear after their first fetched message and are dropped after
+// Config.Health.PartitionTTL without one, retry tier topics are included.
+func (c *Consumer) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Ready returns an error when Config.Health thresholds are exceeded. Only the
+// main topics count towards MaxLag, retry tiers lag behind by design.
+func (c *Consumer) Ready() error {
+	stats := c.Stats()
+	if limit := c.cfg.Health.MaxCommitErrors; limit > 0 && stats.ConsecutiveCommitErrors >= limit {
+		return fmt.Errorf("%w: %d in a row", ErrCommitErrors, stats.ConsecutiveCommitErrors)
+	}
+	if c.cfg.Health.MaxLag <= 0 {
+		return nil
+	}
+
+	var lag int64
+	for _, p := range stats.Partitions {
+		if slices.Contains(c.cfg.Topics, p.Topic) {
+			lag += p.Lag
+		}
+	}
+	if lag > c.cfg.Health.MaxLag {
+		return fmt.Errorf("%w: %d > %d", ErrLagExceeded, lag, c.cfg.Health.MaxLag)
+	}
+	return nil
+}
+
+// ReadyHandler serves Ready as a readiness probe, 503 with the reason when not ready
+func (c *Consumer) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if err := c.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestStatsTrackerExpiresRevokedPartitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		stale     []int
+		wantParts []int
+		wantLag   int64
+	}{
+		{name: "all fetched", wantParts: []int{0, 1}, wantLag: 15},
+		{name: "revoked partition dropped", stale: []int{1}, wantParts: []int{0}, wantLag: 5},
+		{name: "nothing fetched keeps everything", stale: []int{0, 1}, wantParts: []int{0, 1}, wantLag: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newStatsTracker(time.Minute)
+			tracker.fetched(kafka.Message{Topic: "orders", Partition: 0, Offset: 5, HighWaterMark: 10})
+			tracker.fetched(kafka.Message{Topic: "orders", Partition: 1, Offset: 0, HighWaterMark: 10})
+
+			for _, partition := range tt.stale {
+				tracker.partitions[partitionKey{topic: "orders", partition: partition}].fetchedAt = time.Now().Add(-2 * time.Minute)
+			}
+			if len(tt.stale) == 2 {
+				tracker.lastFetch["orders"] = time.Now().Add(-2 * time.Minute)
+			}
+
+			stats := tracker.snapshot()
+			got := make([]int, 0, len(stats.Partitions))
+			for _, p := range stats.Partitions {
+				got = append(got, p.Partition)
+			}
+			if !slices.Equal(got, tt.wantParts) {
+				t.Errorf("partitions = %v, want %v", got, tt.wantParts)
+			}
+			if stats.Lag != tt.wantLag {
+				t.Errorf("lag = %d, want %d", stats.Lag, tt.wantLag)
+			}
+		})
+	}
+}
+
+func TestReadyIgnoresRevokedPartitions(t *testing.T) {
+	c := &Consumer{
+		cfg:   Config{Topics: []string{"orders"}, Health: HealthConfig{MaxLag: 10}},
+		stats: newStatsTracker(time.Minute),
+	}
+	c.stats.fetched(kafka.Message{Topic: "orders", Partition: 0, Offset: 0, HighWaterMark: 100})
+	if err := c.Ready(); err == nil {
+		t.Fatal("Ready = nil with lag 100")
+	}
+
+	// partition 0 moved to another member, only partition 1 is fetched now
+	c.stats.partitions[partitionKey{topic: "orders", partition: 0}].fetchedAt = time.Now().Add(-2 * time.Minute)
+	c.stats.fetched(kafka.Message{Topic: "orders", Partition: 1, Offset: 0, HighWaterMark: 1})
+	if err := c.Ready(); err != nil {
+		t.Errorf("Ready = %v after rebalance", err)
+	}
+}
@@ -0,0 +1,199 @@
+// Package kafkatest is an in-memory broker for tests of code built on
+// kafka/producer and kafka/consumer. Writer implements producer.Writer and
+// Reader implements consumer.Reader, both are plugged in with WithWriter,
+// WithReader, WithReaderFactory and WithRetryWriter.
+package kafkatest
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	defaultPartitions    = 1
+	defaultExpectTimeout = time.Second
+)
+
+type Broker struct {
+	partitions    int
+	expectTimeout time.Duration
+
+	mu     sync.Mutex
+	topics map[string]*topic
+	groups map[string]*group
+	// changed is closed and replaced on every write and group change
+	changed chan struct{}
+}
+
+type topic struct {
+	partitions [][]kafka.Message
+	roundRobin int
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type group struct {
+	committed  map[topicPartition]int64
+	members    []*Reader
+	generation int
+}
+
+func NewBroker(opts ...OptionFunc) *Broker {
+	b := &Broker{
+		partitions:    defaultPartitions,
+		expectTimeout: defaultExpectTimeout,
+		topics:        make(map[string]*topic),
+		groups:        make(map[string]*group),
+		changed:       make(chan struct{}),
+	}
+	return b.With(opts...)
+}
+
+// CreateTopic sets the number of partitions, topics are otherwise created on
+// first use with the broker default
+func (b *Broker) CreateTopic(name string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(name)
+	for len(t.partitions) < partitions {
+		t.partitions = append(t.partitions, nil)
+	}
+}
+
+// Messages returns every message of the topic, partition by partition
+func (b *Broker) Messages(name string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []kafka.Message
+	if t, ok := b.topics[name]; ok {
+		for _, p := range t.partitions {
+			msgs = append(msgs, p...)
+		}
+	}
+	return msgs
+}
+
+// Committed returns the next offset the group reads from the partition, -1 if nothing is committed
+func (b *Broker) Committed(groupID, name string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[groupID]
+	if !ok {
+		return -1
+	}
+	offset, ok := g.committed[topicPartition{topic: name, partition: partition}]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// WaitMessage blocks until the topic has a message matching predicate or ctx is done
+func (b *Broker) WaitMessage(ctx context.Context, name string, predicate func(kafka.Message) bool) (kafka.Message, error) {
+	for {
+		b.mu.Lock()
+		changed := b.changed
+		if t, ok := b.topics[name]; ok {
+			for _, p := range t.partitions {
+				if i := slices.IndexFunc(p, predicate); i >= 0 {
+					b.mu.Unlock()
+					return p[i], nil
+				}
+			}
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// ExpectMessage fails the test when no message matching predicate is written
+// to the topic within the broker expect timeout
+func (b *Broker) ExpectMessage(t testing.TB, name string, predicate func(kafka.Message) bool) kafka.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.expectTimeout)
+	defer cancel()
+	msg, err := b.WaitMessage(ctx, name, predicate)
+	if err != nil {
+		t.Fatalf("kafkatest: no expected message in topic %q after %s", name, b.expectTimeout)
+	}
+	return msg
+}
+
+// ExpectNoMessage fails the test when a message matching predicate is in the topic
+func (b *Broker) ExpectNoMessage(t testing.TB, name string, predicate func(kafka.Message) bool) {
+	t.Helper()
+
+	if i := slices.IndexFunc(b.Messages(name), predicate); i >= 0 {
+		t.Fatalf("kafkatest: unexpected message in topic %q", name)
+	}
+}
+
+// produce must be called with mu held
+func (b *Broker) produce(msg kafka.Message) kafka.Message {
+	t := b.topic(msg.Topic)
+	partition := b.partition(t, msg.Key)
+
+	msg.Partition = partition
+	msg.Offset = int64(len(t.partitions[partition]))
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	msg.Headers = slices.Clone(msg.Headers)
+	t.partitions[partition] = append(t.partitions[partition], msg)
+	return msg
+}
+
+// partition hashes the key, messages without a key are spread round robin
+func (b *Broker) partition(t *topic, key []byte) int {
+	n := len(t.partitions)
+	if len(key) == 0 {
+		t.roundRobin = (t.roundRobin + 1) % n
+		return t.roundRobin
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+// topic must be called with mu held
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{partitions: make([][]kafka.Message, b.partitions)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// group must be called with mu held
+func (b *Broker) group(groupID string) *group {
+	g, ok := b.groups[groupID]
+	if !ok {
+		g = &group{committed: make(map[topicPartition]int64)}
+		b.groups[groupID] = g
+	}
+	return g
+}
+
+// notify must be called with mu held
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
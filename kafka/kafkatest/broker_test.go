@@ -0,0 +1,207 @@
+package kafkatest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	testTopic = "orders"
+	testGroup = "orders-service"
+)
+
+func write(t *testing.T, broker *kafkatest.Broker, keys ...string) {
+	t.Helper()
+	msgs := make([]kafka.Message, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, kafka.Message{Key: []byte(key), Value: []byte(key)})
+	}
+	if err := broker.Writer(testTopic).WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fetch(t *testing.T, r *kafkatest.Reader) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := r.FetchMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// drain fetches until nothing arrives for a while and returns the values,
+// it may run outside the test goroutine
+func drain(t *testing.T, r *kafkatest.Reader) []string {
+	t.Helper()
+	var values []string
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		msg, err := r.FetchMessage(ctx)
+		cancel()
+		if err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Error(err)
+			}
+			return values
+		}
+		values = append(values, string(msg.Value))
+	}
+}
+
+func TestReaderCommit(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	write(t, broker, "a", "b", "c")
+
+	if got := broker.Committed(testGroup, testTopic, 0); got != -1 {
+		t.Fatalf("committed = %d before any commit, want -1", got)
+	}
+
+	r := broker.Reader(testGroup, testTopic)
+	a, b := fetch(t, r), fetch(t, r)
+	if err := r.CommitMessages(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	// an older offset doesn't move the commit back
+	if err := r.CommitMessages(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if got := broker.Committed(testGroup, testTopic, 0); got != 2 {
+		t.Errorf("committed = %d, want 2", got)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.FetchMessage(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("FetchMessage after Close = %v, want %v", err, io.EOF)
+	}
+
+	// the next member of the group starts after the commit
+	next := broker.Reader(testGroup, testTopic)
+	if got := drain(t, next); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("fetched %v after the commit, want [c]", got)
+	}
+
+	if err := broker.Reader("", testTopic).CommitMessages(context.Background(), a); !errors.Is(err, kafkatest.ErrNoGroup) {
+		t.Errorf("CommitMessages without group = %v, want %v", err, kafkatest.ErrNoGroup)
+	}
+}
+
+func TestReaderWaitsForWrite(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	r := broker.Reader(testGroup, testTopic)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if err := broker.Writer(testTopic).WriteMessages(context.Background(), kafka.Message{Value: []byte("late")}); err != nil {
+			t.Error(err)
+		}
+	}()
+	if msg := fetch(t, r); string(msg.Value) != "late" {
+		t.Errorf("fetched %q, want late", msg.Value)
+	}
+}
+
+func TestGroupRebalance(t *testing.T) {
+	broker := kafkatest.NewBroker(kafkatest.WithPartitions(2))
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+	write(t, broker, keys...)
+
+	// the only member reads both partitions but commits nothing
+	first := broker.Reader(testGroup, testTopic)
+	if got := drain(t, first); len(got) != len(keys) {
+		t.Fatalf("single member fetched %v, want all %d", got, len(keys))
+	}
+
+	// a join is a rebalance, uncommitted messages are fetched again and split
+	second := broker.Reader(testGroup, testTopic)
+	var (
+		wg  sync.WaitGroup
+		got [2][]string
+	)
+	for i, r := range []*kafkatest.Reader{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = drain(t, r)
+		}()
+	}
+	wg.Wait()
+	if len(got[0]) == 0 || len(got[1]) == 0 || len(got[0])+len(got[1]) != len(keys) {
+		t.Fatalf("members fetched %v and %v", got[0], got[1])
+	}
+	all := append(slices.Clone(got[0]), got[1]...)
+	slices.Sort(all)
+	if !slices.Equal(all, keys) {
+		t.Errorf("members fetched %v together, want %v", all, keys)
+	}
+
+	// the partition of a member that left goes back to the other one
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(t, first); len(got) != len(keys) {
+		t.Errorf("remaining member fetched %v, want all %d", got, len(keys))
+	}
+}
+
+func TestReaderFactory(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	write(t, broker, "a", "b")
+
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	c, err := consumer.NewConsumer(
+		consumer.Config{Brokers: []string{"kafkatest"}, GroupID: testGroup, Topics: []string{testTopic}, CommitInterval: -1},
+		consumer.HandlerFunc(func(_ context.Context, msg kafka.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, string(msg.Value))
+			return nil
+		}),
+		consumer.WithReaderFactory(broker.ReaderFactory()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for broker.Committed(testGroup, testTopic, 0) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the commit of the factory reader")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(handled, []string{"a", "b"}) {
+		t.Errorf("handled = %v", handled)
+	}
+}
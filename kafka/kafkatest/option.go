@@ -0,0 +1,26 @@
+package kafkatest
+
+import "time"
+
+type OptionFunc func(*Broker)
+
+func (b *Broker) With(opt ...OptionFunc) *Broker {
+	for _, o := range opt {
+		o(b)
+	}
+	return b
+}
+
+// WithPartitions sets the number of partitions of auto-created topics
+func WithPartitions(partitions int) OptionFunc {
+	return func(b *Broker) {
+		b.partitions = max(partitions, 1)
+	}
+}
+
+// WithExpectTimeout sets how long ExpectMessage waits
+func WithExpectTimeout(timeout time.Duration) OptionFunc {
+	return func(b *Broker) {
+		b.expectTimeout = timeout
+	}
+}
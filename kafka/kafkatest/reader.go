@@ -0,0 +1,175 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"slices"
+)
+
+var ErrNoGroup = errors.New("kafkatest: commit without group id")
+
+// Reader reads from the earliest offset unless the group has committed one.
+// Readers of one group split partitions between them, every join and Close
+// is a rebalance: uncommitted messages are fetched again.
+type Reader struct {
+	broker  *Broker
+	groupID string
+	topics  []string
+
+	// positions are the next offsets to fetch, guarded by broker.mu
+	positions  map[topicPartition]int64
+	generation int
+	next       int
+	closed     bool
+}
+
+func (b *Broker) Reader(groupID string, topics ...string) *Reader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := &Reader{
+		broker:    b,
+		groupID:   groupID,
+		topics:    topics,
+		positions: make(map[topicPartition]int64),
+	}
+	for _, name := range topics {
+		b.topic(name)
+	}
+	if groupID != "" {
+		g := b.group(groupID)
+		g.members = append(g.members, r)
+		g.generation++
+		r.generation = g.generation
+		b.notify()
+	}
+	return r
+}
+
+// ReaderFactory is for consumer.WithReaderFactory
+func (b *Broker) ReaderFactory() consumer.ReaderFactory {
+	return func(groupID string, topics []string) consumer.Reader {
+		return b.Reader(groupID, topics...)
+	}
+}
+
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	b := r.broker
+	for {
+		b.mu.Lock()
+		if r.closed {
+			b.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		if msg, ok := r.poll(); ok {
+			b.mu.Unlock()
+			return msg, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (r *Reader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	if r.groupID == "" {
+		return ErrNoGroup
+	}
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(r.groupID)
+	for _, msg := range msgs {
+		tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		if current, ok := g.committed[tp]; !ok || current < msg.Offset+1 {
+			g.committed[tp] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *Reader) Close() error {
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if g, ok := b.groups[r.groupID]; ok {
+		g.members = slices.DeleteFunc(g.members, func(m *Reader) bool { return m == r })
+		g.generation++
+	}
+	b.notify()
+	return nil
+}
+
+// poll returns the next message of the assigned partitions round robin,
+// it must be called with broker.mu held
+func (r *Reader) poll() (kafka.Message, bool) {
+	b := r.broker
+	if g, ok := b.groups[r.groupID]; ok && g.generation != r.generation {
+		r.positions = make(map[topicPartition]int64)
+		r.generation = g.generation
+	}
+
+	assigned := r.assigned()
+	for i := range assigned {
+		tp := assigned[(r.next+i)%len(assigned)]
+		msgs := b.topics[tp.topic].partitions[tp.partition]
+		pos := r.position(tp)
+		if pos >= int64(len(msgs)) {
+			continue
+		}
+
+		r.positions[tp] = pos + 1
+		r.next = (r.next + i + 1) % len(assigned)
+		msg := msgs[pos]
+		msg.HighWaterMark = int64(len(msgs))
+		return msg, true
+	}
+	return kafka.Message{}, false
+}
+
+// assigned spreads partitions of the topics between group members by index
+func (r *Reader) assigned() []topicPartition {
+	b := r.broker
+	member, members := 0, 1
+	if g, ok := b.groups[r.groupID]; ok {
+		member, members = slices.Index(g.members, r), len(g.members)
+	}
+
+	var result []topicPartition
+	i := 0
+	for _, name := range r.topics {
+		for partition := range b.topics[name].partitions {
+			if i%members == member {
+				result = append(result, topicPartition{topic: name, partition: partition})
+			}
+			i++
+		}
+	}
+	return result
+}
+
+func (r *Reader) position(tp topicPartition) int64 {
+	if pos, ok := r.positions[tp]; ok {
+		return pos
+	}
+	if g, ok := r.broker.groups[r.groupID]; ok {
+		if committed, ok := g.committed[tp]; ok {
+			return committed
+		}
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"sync/atomic"
+)
+
+var (
+	ErrTopicNotSet = errors.New("kafkatest: topic must be set on the writer or the message")
+	ErrTopicTwice  = errors.New("kafkatest: topic must not be set on both the writer and the message")
+)
+
+// Writer writes like kafka.Writer: Topic is set either on the writer or on every message
+type Writer struct {
+	broker *Broker
+	topic  string
+	closed atomic.Bool
+}
+
+func (b *Broker) Writer(topic string) *Writer {
+	return &Writer{
+		broker: b,
+		topic:  topic,
+	}
+}
+
+// WriteMessages writes all messages or none
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.closed.Load() {
+		return io.ErrClosedPipe
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i := range msgs {
+		switch {
+		case w.topic != "" && msgs[i].Topic != "":
+			return ErrTopicTwice
+		case w.topic == "" && msgs[i].Topic == "":
+			return ErrTopicNotSet
+		}
+	}
+
+	b := w.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range msgs {
+		if w.topic != "" {
+			msg.Topic = w.topic
+		}
+		b.produce(msg)
+	}
+	b.notify()
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.closed.Store(true)
+	return nil
+}
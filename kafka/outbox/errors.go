@@ -0,0 +1,12 @@
+package outbox
+
+import "errors"
+
+var (
+	ErrLeaseLost      = errors.New("outbox lease lost")
+	ErrLeaseOperation = errors.New("error outbox lease operation")
+	ErrFetchEvents    = errors.New("error fetch outbox events")
+	ErrPublishEvents  = errors.New("error publish outbox events")
+	ErrDeleteEvents   = errors.New("error delete outbox events")
+	ErrUnkeyedWriter  = errors.New("outbox relay writer doesn't balance by key")
+)
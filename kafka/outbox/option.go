@@ -0,0 +1,23 @@
+package outbox
+
+type OptionFunc func(*Relay)
+
+func (r *Relay) With(opt ...OptionFunc) *Relay {
+	for _, o := range opt {
+		o(r)
+	}
+	return r
+}
+
+func WithLogger(logger Logger) OptionFunc {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// WithOwner sets the lease owner id, a random uuid by default
+func WithOwner(owner string) OptionFunc {
+	return func(r *Relay) {
+		r.owner = owner
+	}
+}
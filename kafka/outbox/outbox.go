@@ -0,0 +1,205 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultTable        = "outbox"
+	defaultLeaseTable   = "outbox_lease"
+	defaultShards       = 16
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+	defaultLeaseTTL     = 10 * time.Second
+	defaultClockSkew    = 5 * time.Second
+)
+
+type Config struct {
+	// Table and LeaseTable may be prefixed with a keyspace
+	Table      string
+	LeaseTable string
+	// Shards spread events by key hash, events of one key are relayed in id
+	// order, which is the write order of one writer. Events of one key written
+	// concurrently by several writers are ordered by their clocks.
+	Shards       int
+	BatchSize    int
+	PollInterval time.Duration
+	// LeaseTTL is how long a relay stays leader without renewing, it must be
+	// longer than PollInterval
+	LeaseTTL time.Duration
+	// ClockSkew is how far behind the last relayed id a poll of the shard
+	// starts, so the relay doesn't read the tombstones of relayed events again
+	// and still finds events written later by a writer with a slower clock. An
+	// event older than that is relayed after the lease moves to another relay.
+	ClockSkew time.Duration
+}
+
+// Event is a message to be published to Kafka by the relay
+type Event struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string][]byte
+}
+
+type record struct {
+	Shard   int               `db:"shard"`
+	ID      gocql.UUID        `db:"id"`
+	Topic   string            `db:"topic"`
+	Key     []byte            `db:"key"`
+	Value   []byte            `db:"value"`
+	Headers map[string][]byte `db:"headers"`
+}
+
+// Outbox stores events in Scylla next to business data, Relay publishes them
+type Outbox struct {
+	session *gocqlx.Session
+	cfg     Config
+}
+
+func New(session *gocqlx.Session, cfg Config) *Outbox {
+	if cfg.Table == "" {
+		cfg.Table = defaultTable
+	}
+	if cfg.LeaseTable == "" {
+		cfg.LeaseTable = defaultLeaseTable
+	}
+	if cfg.Shards <= 0 {
+		cfg.Shards = defaultShards
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = defaultLeaseTTL
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = defaultClockSkew
+	}
+
+	return &Outbox{
+		session: session,
+		cfg:     cfg,
+	}
+}
+
+// CreateTables creates the outbox and lease tables if they don't exist
+func (o *Outbox) CreateTables() error {
+	err := o.session.ExecStmt(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		shard int,
+		id timeuuid,
+		topic text,
+		key blob,
+		value blob,
+		headers map<text, blob>,
+		PRIMARY KEY ((shard), id)
+	) WITH CLUSTERING ORDER BY (id ASC)`, o.cfg.Table))
+	if err != nil {
+		return err
+	}
+
+	return o.session.ExecStmt(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		name text PRIMARY KEY,
+		owner text
+	)`, o.cfg.LeaseTable))
+}
+
+// AddToBatch adds the event insert to a logged batch with the business writes,
+// so both are applied or none.
+func (o *Outbox) AddToBatch(batch *gocqlx.Batch, ev Event) error {
+	return batch.BindStruct(o.insertQuery(context.Background()), o.newRecord(ev))
+}
+
+// Add inserts the event alone, use AddToBatch to write it atomically with other data
+func (o *Outbox) Add(ctx context.Context, ev Event) error {
+	return o.insertQuery(ctx).BindStruct(o.newRecord(ev)).ExecRelease()
+}
+
+func (o *Outbox) insertQuery(ctx context.Context) *gocqlx.Queryx {
+	return o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (shard, id, topic, key, value, headers) VALUES (?, ?, ?, ?, ?, ?)", o.cfg.Table),
+		[]string{"shard", "id", "topic", "key", "value", "headers"},
+	)
+}
+
+func (o *Outbox) newRecord(ev Event) record {
+	return record{
+		Shard:   o.shard(ev.Key),
+		ID:      gocql.TimeUUID(),
+		Topic:   ev.Topic,
+		Key:     ev.Key,
+		Value:   ev.Value,
+		Headers: ev.Headers,
+	}
+}
+
+func (o *Outbox) shard(key []byte) int {
+	if len(key) == 0 {
+		return rand.IntN(o.cfg.Shards)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(o.cfg.Shards))
+}
+
+// fetch reads events of the shard with ids after the since time, the range
+// keeps the poll from scanning the tombstones of the events relayed before
+func (o *Outbox) fetch(ctx context.Context, shard int, since time.Time) ([]record, error) {
+	var records []record
+	err := o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("SELECT shard, id, topic, key, value, headers FROM %s WHERE shard = ? AND id > ? ORDER BY id ASC LIMIT ?", o.cfg.Table),
+		[]string{"shard", "id", "limit"},
+	).Bind(shard, gocql.MinTimeUUID(since), o.cfg.BatchSize).SelectRelease(&records)
+	return records, err
+}
+
+// delete removes relayed events by id. A range delete up to the last id would
+// also remove events with a smaller timeuuid committed after the fetch, e.g.
+// from a writer with a skewed clock, before they are relayed.
+func (o *Outbox) delete(ctx context.Context, shard int, ids []gocql.UUID) error {
+	return o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE shard = ? AND id IN ?", o.cfg.Table),
+		[]string{"shard", "id"},
+	).Bind(shard, ids).ExecRelease()
+}
+
+func (o *Outbox) acquireLease(ctx context.Context, owner string) (bool, error) {
+	return o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (name, owner) VALUES (?, ?) IF NOT EXISTS USING TTL ?", o.cfg.LeaseTable),
+		[]string{"name", "owner", "ttl"},
+	).Bind(o.cfg.Table, owner, o.leaseTTLSeconds()).ExecCASRelease()
+}
+
+func (o *Outbox) renewLease(ctx context.Context, owner string) (bool, error) {
+	return o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("UPDATE %s USING TTL ? SET owner = ? WHERE name = ? IF owner = ?", o.cfg.LeaseTable),
+		[]string{"ttl", "owner", "name", "current_owner"},
+	).Bind(o.leaseTTLSeconds(), owner, o.cfg.Table, owner).ExecCASRelease()
+}
+
+func (o *Outbox) releaseLease(ctx context.Context, owner string) error {
+	_, err := o.session.ContextQuery(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE name = ? IF owner = ?", o.cfg.LeaseTable),
+		[]string{"name", "owner"},
+	).Bind(o.cfg.Table, owner).ExecCASRelease()
+	return err
+}
+
+func (o *Outbox) leaseTTLSeconds() int {
+	return int(max(o.cfg.LeaseTTL/time.Second, 1))
+}
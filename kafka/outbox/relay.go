@@ -0,0 +1,212 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const releaseTimeout = 5 * time.Second
+
+// fetchFrom is the since time of a shard without relayed events, it is before any timeuuid in use
+var fetchFrom = time.Unix(0, 0)
+
+type Logger interface {
+	Infow(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// store is the Scylla side of the relay, Outbox implements it
+type store interface {
+	fetch(ctx context.Context, shard int, since time.Time) ([]record, error)
+	delete(ctx context.Context, shard int, ids []gocql.UUID) error
+	acquireLease(ctx context.Context, owner string) (bool, error)
+	renewLease(ctx context.Context, owner string) (bool, error)
+	releaseLease(ctx context.Context, owner string) error
+}
+
+// Relay publishes outbox events through a producer. Only the replica holding
+// the lease relays, events are deleted after the write is acknowledged, so
+// delivery is at-least-once. Events of a key stay ordered in Kafka only when
+// the writer picks partitions by key.
+type Relay struct {
+	store  store
+	cfg    Config
+	writer producer.Writer
+	logger Logger
+	owner  string
+
+	leader    bool
+	renewedAt time.Time
+	// since is the per shard start of the next fetch, it is reset on acquiring the lease
+	since map[int]time.Time
+}
+
+// NewRelay needs a writer without a default topic, every event carries its own.
+// The writer must use a key hash balancer to keep per key order, e.g. from
+// producer.NewProducer with producer.BalancerHash, a *kafka.Writer with another
+// balancer is rejected with ErrUnkeyedWriter.
+func NewRelay(outbox *Outbox, writer producer.Writer, opts ...OptionFunc) (*Relay, error) {
+	if w, ok := writer.(*kafka.Writer); ok && !keyedBalancer(w.Balancer) {
+		return nil, fmt.Errorf("%w: %T", ErrUnkeyedWriter, w.Balancer)
+	}
+	return newRelay(outbox, outbox.cfg, writer, opts...), nil
+}
+
+func newRelay(store store, cfg Config, writer producer.Writer, opts ...OptionFunc) *Relay {
+	r := &Relay{
+		store:  store,
+		cfg:    cfg,
+		writer: writer,
+		logger: log.Default(),
+		owner:  uuid.New().String(),
+		since:  make(map[int]time.Time),
+	}
+	return r.With(opts...)
+}
+
+func keyedBalancer(balancer kafka.Balancer) bool {
+	switch balancer.(type) {
+	case *kafka.Hash, *kafka.ReferenceHash,
+		*kafka.CRC32Balancer, kafka.CRC32Balancer, *kafka.Murmur2Balancer, kafka.Murmur2Balancer:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run relays events every PollInterval until ctx is canceled
+func (r *Relay) Run(ctx context.Context) error {
+	defer r.release()
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.relay(ctx); err != nil {
+			r.logger.Errorw("outbox relay error", "owner", r.owner, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context) error {
+	for shard := 0; shard < r.cfg.Shards; shard++ {
+		if err := r.ensureLease(ctx); err != nil || !r.leader {
+			return err
+		}
+		if err := r.relayShard(ctx, shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Relay) relayShard(ctx context.Context, shard int) error {
+	for {
+		since, ok := r.since[shard]
+		if !ok {
+			since = fetchFrom
+		}
+		records, err := r.store.fetch(ctx, shard, since)
+		if err != nil {
+			return errors.Join(err, ErrFetchEvents)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		msgs := make([]kafka.Message, 0, len(records))
+		ids := make([]gocql.UUID, 0, len(records))
+		for _, rec := range records {
+			msgs = append(msgs, toMessage(rec))
+			ids = append(ids, rec.ID)
+		}
+		// the whole batch is retried on error, already written messages are duplicated
+		if err := r.writer.WriteMessages(ctx, msgs...); err != nil {
+			return errors.Join(log.Wrap("relay shard", err, log.Fld{"shard": shard}), ErrPublishEvents)
+		}
+		if err := r.store.delete(ctx, shard, ids); err != nil {
+			return errors.Join(log.Wrap("relay shard", err, log.Fld{"shard": shard}), ErrDeleteEvents)
+		}
+		if next := records[len(records)-1].ID.Time().Add(-r.cfg.ClockSkew); next.After(since) {
+			r.since[shard] = next
+		}
+
+		if len(records) < r.cfg.BatchSize {
+			return nil
+		}
+		if err := r.ensureLease(ctx); err != nil || !r.leader {
+			return err
+		}
+	}
+}
+
+// ensureLease acquires the lease or renews it once a third of the TTL has passed
+func (r *Relay) ensureLease(ctx context.Context) error {
+	if r.leader && time.Since(r.renewedAt) < r.cfg.LeaseTTL/3 {
+		return nil
+	}
+
+	var (
+		applied bool
+		err     error
+	)
+	if r.leader {
+		applied, err = r.store.renewLease(ctx, r.owner)
+	} else {
+		applied, err = r.store.acquireLease(ctx, r.owner)
+	}
+	if err != nil {
+		r.leader = false
+		return errors.Join(err, ErrLeaseOperation)
+	}
+
+	if r.leader && !applied {
+		r.leader = false
+		return ErrLeaseLost
+	}
+	if !r.leader && applied {
+		// another relay may have left events behind its fetch range
+		clear(r.since)
+		r.logger.Infow("outbox relay became leader", "owner", r.owner)
+	}
+	r.leader = applied
+	r.renewedAt = time.Now()
+	return nil
+}
+
+func (r *Relay) release() {
+	if !r.leader {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := r.store.releaseLease(ctx, r.owner); err != nil {
+		r.logger.Errorw("error releasing outbox lease", "owner", r.owner, "error", err)
+	}
+	r.leader = false
+}
+
+func toMessage(rec record) kafka.Message {
+	headers := make([]kafka.Header, 0, len(rec.Headers))
+	for k, v := range rec.Headers {
+		headers = append(headers, kafka.Header{Key: k, Value: v})
+	}
+	return kafka.Message{
+		Topic:   rec.Topic,
+		Key:     rec.Key,
+		Value:   rec.Value,
+		Headers: headers,
+	}
+}
@@ -0,0 +1,345 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKeyedBalancer(t *testing.T) {
+	tests := []struct {
+		balancer kafka.Balancer
+		want     bool
+	}{
+		{nil, false},
+		{&kafka.LeastBytes{}, false},
+		{&kafka.RoundRobin{}, false},
+		{&kafka.Hash{}, true},
+		{&kafka.ReferenceHash{}, true},
+		{&kafka.CRC32Balancer{}, true},
+		{kafka.CRC32Balancer{}, true},
+		{&kafka.Murmur2Balancer{}, true},
+		{kafka.Murmur2Balancer{}, true},
+	}
+	for _, tt := range tests {
+		if got := keyedBalancer(tt.balancer); got != tt.want {
+			t.Errorf("keyedBalancer(%T) = %v, want %v", tt.balancer, got, tt.want)
+		}
+	}
+}
+
+func TestNewRelayRejectsUnkeyedWriter(t *testing.T) {
+	outbox := New(nil, Config{})
+	if _, err := NewRelay(outbox, &kafka.Writer{Balancer: &kafka.RoundRobin{}}); !errors.Is(err, ErrUnkeyedWriter) {
+		t.Errorf("NewRelay = %v, want %v", err, ErrUnkeyedWriter)
+	}
+	if _, err := NewRelay(outbox, &kafka.Writer{Balancer: &kafka.Hash{}}); err != nil {
+		t.Errorf("NewRelay = %v with a hash balancer", err)
+	}
+}
+
+// fakeStore keeps events and the lease in memory and records the operations of relays
+type fakeStore struct {
+	mu     sync.Mutex
+	shards map[int][]record
+	owner  string
+	ops    []string
+	// lost makes renewals fail as if the lease expired
+	lost bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{shards: make(map[int][]record)}
+}
+
+func (s *fakeStore) add(shard int, value string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shards[shard] = append(s.shards[shard], record{Shard: shard, ID: gocql.UUIDFromTime(at), Topic: "events", Value: []byte(value)})
+	slices.SortFunc(s.shards[shard], func(a, b record) int { return a.ID.Time().Compare(b.ID.Time()) })
+}
+
+func (s *fakeStore) record(op string) {
+	s.ops = append(s.ops, op)
+}
+
+func (s *fakeStore) fetch(_ context.Context, shard int, since time.Time) ([]record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(fmt.Sprintf("fetch %d", shard))
+	var records []record
+	for _, rec := range s.shards[shard] {
+		if rec.ID.Time().After(since) && len(records) < testBatchSize {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (s *fakeStore) delete(_ context.Context, shard int, ids []gocql.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(fmt.Sprintf("delete %d %d", shard, len(ids)))
+	s.shards[shard] = slices.DeleteFunc(s.shards[shard], func(rec record) bool {
+		return slices.Contains(ids, rec.ID)
+	})
+	return nil
+}
+
+func (s *fakeStore) acquireLease(_ context.Context, owner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner != "" && s.owner != owner {
+		return false, nil
+	}
+	s.owner = owner
+	return true, nil
+}
+
+func (s *fakeStore) renewLease(_ context.Context, owner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owner == owner && !s.lost, nil
+}
+
+func (s *fakeStore) releaseLease(_ context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner == owner {
+		s.owner = ""
+	}
+	return nil
+}
+
+func (s *fakeStore) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, records := range s.shards {
+		n += len(records)
+	}
+	return n
+}
+
+func (s *fakeStore) operations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ops)
+}
+
+// fakeWriter writes into the store's operation log, so writes and deletes are ordered
+type fakeWriter struct {
+	store *fakeStore
+	err   error
+
+	mu     sync.Mutex
+	values []string
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.store.mu.Lock()
+	w.store.record(fmt.Sprintf("write %d", len(msgs)))
+	w.store.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, msg := range msgs {
+		w.values = append(w.values, string(msg.Value))
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func (w *fakeWriter) written() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.values)
+}
+
+const testBatchSize = 2
+
+func testRelayConfig() Config {
+	return Config{
+		Shards:       2,
+		BatchSize:    testBatchSize,
+		PollInterval: 10 * time.Millisecond,
+		LeaseTTL:     time.Minute,
+		ClockSkew:    time.Second,
+	}
+}
+
+func TestRelayWritesBeforeDelete(t *testing.T) {
+	store := newFakeStore()
+	start := time.Now().Add(-time.Minute)
+	store.add(0, "a1", start)
+	store.add(0, "a2", start.Add(time.Second))
+	store.add(0, "a3", start.Add(2*time.Second))
+	store.add(1, "b1", start)
+
+	writer := &fakeWriter{store: store}
+	r := newRelay(store, testRelayConfig(), writer)
+	if err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"fetch 0", "write 2", "delete 0 2",
+		"fetch 0", "write 1", "delete 0 1",
+		"fetch 1", "write 1", "delete 1 1",
+	}
+	if got := store.operations(); !slices.Equal(got, want) {
+		t.Errorf("operations = %v, want %v", got, want)
+	}
+	if got := writer.written(); !slices.Equal(got, []string{"a1", "a2", "a3", "b1"}) {
+		t.Errorf("written = %v", got)
+	}
+	if store.pending() != 0 {
+		t.Errorf("pending = %d, want 0", store.pending())
+	}
+}
+
+func TestRelayKeepsEventsOnWriteError(t *testing.T) {
+	store := newFakeStore()
+	store.add(0, "a1", time.Now())
+
+	r := newRelay(store, testRelayConfig(), &fakeWriter{store: store, err: errors.New("broker down")})
+	if err := r.relay(context.Background()); !errors.Is(err, ErrPublishEvents) {
+		t.Fatalf("relay = %v, want %v", err, ErrPublishEvents)
+	}
+	if got := store.operations(); !slices.Equal(got, []string{"fetch 0", "write 1"}) {
+		t.Errorf("operations = %v", got)
+	}
+	if store.pending() != 1 {
+		t.Errorf("pending = %d, want 1", store.pending())
+	}
+}
+
+func TestRelayFetchRange(t *testing.T) {
+	store := newFakeStore()
+	cfg := testRelayConfig()
+	now := time.Now()
+	store.add(0, "a1", now)
+
+	writer := &fakeWriter{store: store}
+	r := newRelay(store, cfg, writer)
+	if err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a slower writer within ClockSkew is found, an older event waits for a new leader
+	store.add(0, "late", now.Add(-cfg.ClockSkew/2))
+	store.add(0, "stale", now.Add(-2*cfg.ClockSkew))
+	if err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.written(); !slices.Equal(got, []string{"a1", "late"}) {
+		t.Fatalf("written = %v", got)
+	}
+
+	r.release()
+	if err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.written(); !slices.Equal(got, []string{"a1", "late", "stale"}) {
+		t.Errorf("written = %v after the lease moved", got)
+	}
+}
+
+func TestRelayRun(t *testing.T) {
+	store := newFakeStore()
+	store.add(0, "a1", time.Now())
+	writer := &fakeWriter{store: store}
+	r := newRelay(store, testRelayConfig(), writer, WithOwner("leader"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+	waitFor(t, "a1 relayed", func() bool { return store.pending() == 0 })
+	store.add(1, "b1", time.Now())
+	waitFor(t, "b1 relayed on the next poll", func() bool { return store.pending() == 0 })
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.written(); !slices.Equal(got, []string{"a1", "b1"}) {
+		t.Errorf("written = %v", got)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.owner != "" {
+		t.Errorf("lease owner = %q after Run returned", store.owner)
+	}
+}
+
+func TestRelayLease(t *testing.T) {
+	store := newFakeStore()
+	cfg := testRelayConfig()
+	leaderWriter, followerWriter := &fakeWriter{store: store}, &fakeWriter{store: store}
+	leader := newRelay(store, cfg, leaderWriter, WithOwner("leader"))
+	follower := newRelay(store, cfg, followerWriter, WithOwner("follower"))
+
+	if err := leader.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	store.add(0, "a1", time.Now())
+	if err := follower.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if follower.leader || len(followerWriter.written()) != 0 {
+		t.Fatalf("follower wrote %v while the lease is held", followerWriter.written())
+	}
+
+	leader.release()
+	if err := follower.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := followerWriter.written(); !slices.Equal(got, []string{"a1"}) {
+		t.Errorf("follower wrote %v, want [a1]", got)
+	}
+}
+
+func TestRelayLeaseLost(t *testing.T) {
+	store := newFakeStore()
+	cfg := testRelayConfig()
+	cfg.LeaseTTL = time.Nanosecond
+	writer := &fakeWriter{store: store}
+	r := newRelay(store, cfg, writer)
+	if err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	store.lost = true
+	store.add(0, "a1", time.Now())
+	if err := r.relay(context.Background()); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("relay = %v, want %v", err, ErrLeaseLost)
+	}
+	if len(writer.written()) != 0 || r.leader {
+		t.Errorf("written %v, leader %v after losing the lease", writer.written(), r.leader)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
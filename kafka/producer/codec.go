@@ -0,0 +1,51 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ProtoCodec works with generated message pointers, e.g. ProtoCodec[*pb.Event]
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Decode(data []byte) (T, error) {
+	var zero T
+	v, ok := zero.ProtoReflect().New().Interface().(T)
+	if !ok {
+		return zero, fmt.Errorf("can't create %T", zero)
+	}
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+type RawCodec struct{}
+
+func (RawCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (RawCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
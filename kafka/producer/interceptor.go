@@ -0,0 +1,87 @@
+package producer
+
+import (
+	"context"
+	"github.com/MikhailGulkin/packages/kafka/tracecontext"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/segmentio/kafka-go"
+	"slices"
+)
+
+type WriteFunc func(ctx context.Context, msgs ...kafka.Message) error
+
+// Interceptor wraps every write of a Producer, it is the producer side of consumer.Middleware
+type Interceptor func(next WriteFunc) WriteFunc
+
+// Chain runs interceptors in order, the first one is the outermost
+func Chain(interceptors ...Interceptor) Interceptor {
+	return func(next WriteFunc) WriteFunc {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			next = interceptors[i](next)
+		}
+		return next
+	}
+}
+
+// Intercept wraps a plain Writer, e.g. the one used by the outbox relay
+func Intercept(w Writer, interceptors ...Interceptor) Writer {
+	return &interceptedWriter{
+		Writer: w,
+		write:  Chain(interceptors...)(w.WriteMessages),
+	}
+}
+
+type interceptedWriter struct {
+	Writer
+	write WriteFunc
+}
+
+func (w *interceptedWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return w.write(ctx, msgs...)
+}
+
+// RequestID sets the x-request-id header from log.RequestIDFromContext, Producer adds it by default
+func RequestID() Interceptor {
+	return func(next WriteFunc) WriteFunc {
+		return func(ctx context.Context, msgs ...kafka.Message) error {
+			requestID := log.RequestIDFromContext(ctx)
+			if requestID == "" {
+				return next(ctx, msgs...)
+			}
+			return next(ctx, withHeader(msgs, HeaderRequestID, requestID)...)
+		}
+	}
+}
+
+// TraceParent sets the W3C traceparent of a new span, child of the one in ctx
+// or the root of a new trace
+func TraceParent() Interceptor {
+	return func(next WriteFunc) WriteFunc {
+		return func(ctx context.Context, msgs ...kafka.Message) error {
+			span, ok := tracecontext.FromContext(ctx)
+			if ok {
+				span = span.Child()
+			} else {
+				span = tracecontext.New()
+			}
+
+			msgs = withHeader(msgs, tracecontext.HeaderTraceParent, span.String())
+			if span.State != "" {
+				msgs = withHeader(msgs, tracecontext.HeaderTraceState, span.State)
+			}
+			return next(ctx, msgs...)
+		}
+	}
+}
+
+// withHeader returns copies of msgs with the header added where it is not set yet
+func withHeader(msgs []kafka.Message, key, value string) []kafka.Message {
+	result := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		if !slices.ContainsFunc(msg.Headers, func(h kafka.Header) bool { return h.Key == key }) {
+			msg.Headers = append(slices.Clip(msg.Headers), kafka.Header{Key: key, Value: []byte(value)})
+		}
+		result[i] = msg
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package producer
+
+type OptionFunc[T any] func(*Producer[T])
+
+func (p *Producer[T]) With(opt ...OptionFunc[T]) *Producer[T] {
+	for _, o := range opt {
+		o(p)
+	}
+	return p
+}
+
+func WithKey[T any](key KeyFunc[T]) OptionFunc[T] {
+	return func(p *Producer[T]) {
+		p.key = key
+	}
+}
+
+// WithHeaders adds header functions evaluated for every Send
+func WithHeaders[T any](headers ...HeaderFunc) OptionFunc[T] {
+	return func(p *Producer[T]) {
+		p.headers = append(p.headers, headers...)
+	}
+}
+
+// WithWriter replaces the kafka.Writer built from Config, e.g. with kafkatest
+func WithWriter[T any](writer Writer) OptionFunc[T] {
+	return func(p *Producer[T]) {
+		p.writer = writer
+	}
+}
+
+// WithInterceptors adds interceptors after the default RequestID one
+func WithInterceptors[T any](interceptors ...Interceptor) OptionFunc[T] {
+	return func(p *Producer[T]) {
+		p.interceptors = append(p.interceptors, interceptors...)
+	}
+}
@@ -1,18 +1,125 @@
 package producer
 
-import "github.com/segmentio/kafka-go"
+import (
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const (
+	BalancerLeastBytes = "least_bytes"
+	BalancerRoundRobin = "round_robin"
+	BalancerHash       = "hash"
+	BalancerCRC32      = "crc32"
+	BalancerMurmur2    = "murmur2"
+
+	defaultIdempotentMaxAttempts = 10
+)
 
 type Config struct {
 	Brokers []string
-	Topic   string
+	// Topic may be empty, then every message must have its Topic set
+	Topic string
+
+	// Balancer is least_bytes (default), round_robin, hash, crc32 or murmur2,
+	// keyed balancers keep messages with the same key in one partition.
+	Balancer     string
+	BatchSize    int
+	BatchBytes   int64
+	BatchTimeout time.Duration
+	// Compression is none (default), gzip, snappy, lz4 or zstd
+	Compression string
+	// RequiredAcks is none, one or all, kafka-go defaults to none
+	RequiredAcks    string
+	MaxAttempts     int
+	WriteBackoffMin time.Duration
+	WriteBackoffMax time.Duration
+	// Idempotent requires acks from all replicas, retries writes and sets an
+	// x-message-id header once per message, so consumers can drop duplicates
+	// produced by retries. kafka-go has no broker-side idempotent producer.
+	Idempotent bool
+	// MaxInFlight limits concurrent async sends of Producer, default 100
+	MaxInFlight int
+}
+
+// Writer is the part of *kafka.Writer used by the packages built on the producer
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
 }
 
 func NewProducer(config Config) (*kafka.Writer, error) {
+	balancer, err := newBalancer(config.Balancer)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := newCompression(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var acks kafka.RequiredAcks
+	if config.RequiredAcks != "" {
+		if err := acks.UnmarshalText([]byte(config.RequiredAcks)); err != nil {
+			return nil, err
+		}
+	}
+	maxAttempts := config.MaxAttempts
+	if config.Idempotent {
+		acks = kafka.RequireAll
+		if maxAttempts <= 0 {
+			maxAttempts = defaultIdempotentMaxAttempts
+		}
+	}
+
 	w := &kafka.Writer{
-		Addr:     kafka.TCP(config.Brokers...),
-		Topic:    config.Topic,
-		Balancer: &kafka.LeastBytes{},
+		Addr:            kafka.TCP(config.Brokers...),
+		Topic:           config.Topic,
+		Balancer:        balancer,
+		BatchSize:       config.BatchSize,
+		BatchBytes:      config.BatchBytes,
+		BatchTimeout:    config.BatchTimeout,
+		Compression:     compression,
+		RequiredAcks:    acks,
+		MaxAttempts:     maxAttempts,
+		WriteBackoffMin: config.WriteBackoffMin,
+		WriteBackoffMax: config.WriteBackoffMax,
 	}
 
 	return w, nil
 }
+
+func newBalancer(name string) (kafka.Balancer, error) {
+	switch name {
+	case "", BalancerLeastBytes:
+		return &kafka.LeastBytes{}, nil
+	case BalancerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	case BalancerHash:
+		return &kafka.Hash{}, nil
+	case BalancerCRC32:
+		return &kafka.CRC32Balancer{}, nil
+	case BalancerMurmur2:
+		return &kafka.Murmur2Balancer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancer %q", name)
+	}
+}
+
+func newCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", name)
+	}
+}
@@ -0,0 +1,174 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"sync"
+)
+
+const (
+	HeaderRequestID = "x-request-id"
+	HeaderMessageID = "x-message-id"
+
+	defaultMaxInFlight = 100
+)
+
+var (
+	ErrProducerClosed = errors.New("producer is closed")
+	ErrEncodeMessage  = errors.New("error encode message")
+	ErrWriteMessage   = errors.New("error write message")
+)
+
+type KeyFunc[T any] func(v T) []byte
+
+// HeaderFunc returns headers added to every message sent with ctx
+type HeaderFunc func(ctx context.Context) []kafka.Header
+
+type Callback func(msg kafka.Message, err error)
+
+// Producer encodes values of T with a Codec and writes them through a Writer
+type Producer[T any] struct {
+	writer       Writer
+	codec        Codec[T]
+	key          KeyFunc[T]
+	headers      []HeaderFunc
+	interceptors []Interceptor
+	chain        Interceptor
+	write        WriteFunc
+	idempotent   bool
+
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	closed   bool
+}
+
+func New[T any](config Config, codec Codec[T], opts ...OptionFunc[T]) (*Producer[T], error) {
+	maxInFlight := config.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+
+	p := &Producer[T]{
+		codec:        codec,
+		interceptors: []Interceptor{RequestID()},
+		idempotent:   config.Idempotent,
+		inFlight:     make(chan struct{}, maxInFlight),
+	}
+	p.With(opts...)
+
+	if p.writer == nil {
+		w, err := NewProducer(config)
+		if err != nil {
+			return nil, err
+		}
+		p.writer = w
+	}
+	p.chain = Chain(p.interceptors...)
+	p.write = p.chain(p.writer.WriteMessages)
+
+	return p, nil
+}
+
+// Send writes values synchronously, one batch for all of them
+func (p *Producer[T]) Send(ctx context.Context, values ...T) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	msgs, err := p.messages(ctx, values...)
+	if err != nil {
+		return err
+	}
+	if err := p.write(ctx, msgs...); err != nil {
+		return errors.Join(err, ErrWriteMessage)
+	}
+	return nil
+}
+
+// SendAsync writes value in background and calls callback with the result and
+// the message as the interceptors passed it to the writer, it blocks when
+// MaxInFlight sends are running. Order is not kept between async sends, use
+// Send for messages which must stay ordered.
+func (p *Producer[T]) SendAsync(ctx context.Context, value T, callback Callback) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		callback(kafka.Message{}, ErrProducerClosed)
+		return
+	}
+
+	msgs, err := p.messages(ctx, value)
+	if err != nil {
+		callback(kafka.Message{}, err)
+		return
+	}
+
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		callback(msgs[0], ctx.Err())
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.inFlight
+			p.wg.Done()
+		}()
+		written := msgs
+		err := p.chain(func(ctx context.Context, msgs ...kafka.Message) error {
+			written = msgs
+			return p.writer.WriteMessages(ctx, msgs...)
+		})(context.WithoutCancel(ctx), msgs...)
+		if err != nil {
+			err = errors.Join(err, ErrWriteMessage)
+		}
+		callback(written[0], err)
+	}()
+}
+
+// Close waits for async sends and closes the writer
+func (p *Producer[T]) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return p.writer.Close()
+}
+
+func (p *Producer[T]) messages(ctx context.Context, values ...T) ([]kafka.Message, error) {
+	headers := make([]kafka.Header, 0)
+	for _, h := range p.headers {
+		headers = append(headers, h(ctx)...)
+	}
+
+	msgs := make([]kafka.Message, 0, len(values))
+	for _, v := range values {
+		value, err := p.codec.Encode(v)
+		if err != nil {
+			return nil, errors.Join(err, ErrEncodeMessage)
+		}
+		msg := kafka.Message{
+			Value:   value,
+			Headers: append([]kafka.Header(nil), headers...),
+		}
+		if p.key != nil {
+			msg.Key = p.key(v)
+		}
+		if p.idempotent {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: HeaderMessageID, Value: []byte(uuid.New().String())})
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
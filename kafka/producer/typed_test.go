@@ -0,0 +1,116 @@
+package producer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/kafka/tracecontext"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/segmentio/kafka-go"
+)
+
+const testTopic = "events"
+
+func newTestProducer(t *testing.T, broker *kafkatest.Broker, opts ...producer.OptionFunc[[]byte]) *producer.Producer[[]byte] {
+	t.Helper()
+	p, err := producer.New(
+		producer.Config{MaxInFlight: 4},
+		producer.RawCodec{},
+		append([]producer.OptionFunc[[]byte]{producer.WithWriter[[]byte](broker.Writer(testTopic))}, opts...)...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSendAsyncCallbackGetsWrittenMessage(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	p := newTestProducer(t, broker, producer.WithInterceptors[[]byte](producer.TraceParent()))
+	defer p.Close()
+
+	type result struct {
+		msg kafka.Message
+		err error
+	}
+	results := make(chan result, 1)
+	ctx := log.ContextWithRequestID(context.Background(), "req-1")
+	p.SendAsync(ctx, []byte("a"), func(msg kafka.Message, err error) {
+		results <- result{msg: msg, err: err}
+	})
+
+	var got result
+	select {
+	case got = <-results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not called")
+	}
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+
+	written := broker.ExpectMessage(t, testTopic, func(kafka.Message) bool { return true })
+	for _, key := range []string{producer.HeaderRequestID, tracecontext.HeaderTraceParent} {
+		want, ok := consumer.Header(written, key)
+		if !ok {
+			t.Fatalf("written message has no %s", key)
+		}
+		if value, _ := consumer.Header(got.msg, key); value != want {
+			t.Errorf("callback %s = %q, want %q", key, value, want)
+		}
+	}
+}
+
+func TestSendAsyncConcurrentClose(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	p := newTestProducer(t, broker)
+
+	const senders, sends = 8, 50
+	var (
+		wg        sync.WaitGroup
+		callbacks atomic.Int64
+		succeeded atomic.Int64
+	)
+	for range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range sends {
+				p.SendAsync(context.Background(), []byte("v"), func(_ kafka.Message, err error) {
+					callbacks.Add(1)
+					switch {
+					case err == nil:
+						succeeded.Add(1)
+					case !errors.Is(err, producer.ErrProducerClosed):
+						t.Errorf("callback error = %v", err)
+					}
+				})
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// every send accepted before Close has finished, later ones fail at once
+	written := int64(len(broker.Messages(testTopic)))
+	wg.Wait()
+
+	if got := callbacks.Load(); got != senders*sends {
+		t.Errorf("callbacks = %d, want %d", got, senders*sends)
+	}
+	if got := succeeded.Load(); got != written {
+		t.Errorf("succeeded = %d, written before Close returned = %d", got, written)
+	}
+	if err := p.Send(context.Background(), []byte("late")); !errors.Is(err, producer.ErrProducerClosed) {
+		t.Errorf("Send after Close = %v, want %v", err, producer.ErrProducerClosed)
+	}
+}
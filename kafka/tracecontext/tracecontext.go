@@ -0,0 +1,118 @@
+// Package tracecontext carries W3C Trace Context (traceparent, tracestate)
+// through ctx and Kafka headers, so traces continue across producers and consumers.
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+
+	TraceIDField = "trace_id"
+	SpanIDField  = "span_id"
+
+	flagSampled = 0x01
+)
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// TraceParent is the traceparent of the current span
+type TraceParent struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	// State is the opaque tracestate propagated as is
+	State string
+}
+
+type ctxKey struct{}
+
+// New starts a trace, the span is sampled
+func New() TraceParent {
+	var tp TraceParent
+	_, _ = rand.Read(tp.TraceID[:])
+	_, _ = rand.Read(tp.SpanID[:])
+	tp.Flags = flagSampled
+	return tp
+}
+
+// Parse reads the version 00 format: 00-<trace-id>-<parent-id>-<flags>. Later
+// versions are read by the same prefix as the spec requires, version ff and
+// all zero ids are invalid.
+func Parse(header string) (TraceParent, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidTraceParent, header)
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return TraceParent{}, invalid
+	}
+
+	var (
+		tp             TraceParent
+		version, flags [1]byte
+	)
+	if err := decodeHex(version[:], parts[0]); err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return TraceParent{}, invalid
+	}
+	if err := decodeHex(tp.TraceID[:], parts[1]); err != nil {
+		return TraceParent{}, invalid
+	}
+	if err := decodeHex(tp.SpanID[:], parts[2]); err != nil {
+		return TraceParent{}, invalid
+	}
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return TraceParent{}, invalid
+	}
+	if !tp.IsValid() {
+		return TraceParent{}, invalid
+	}
+	tp.Flags = flags[0]
+	return tp, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return ErrInvalidTraceParent
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceIDString(), tp.SpanIDString(), tp.Flags)
+}
+
+func (tp TraceParent) TraceIDString() string {
+	return hex.EncodeToString(tp.TraceID[:])
+}
+
+func (tp TraceParent) SpanIDString() string {
+	return hex.EncodeToString(tp.SpanID[:])
+}
+
+func (tp TraceParent) IsValid() bool {
+	return tp.TraceID != [16]byte{} && tp.SpanID != [8]byte{}
+}
+
+// Child is a new span of the same trace
+func (tp TraceParent) Child() TraceParent {
+	child := tp
+	_, _ = rand.Read(child.SpanID[:])
+	return child
+}
+
+func ContextWith(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, ctxKey{}, tp)
+}
+
+// FromContext returns the span stored with ContextWith
+func FromContext(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(ctxKey{}).(TraceParent)
+	return tp, ok && tp.IsValid()
+}
@@ -0,0 +1,138 @@
+package tracecontext_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/kafka/tracecontext"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantValid bool
+		wantFlags byte
+	}{
+		{name: "version 00", header: "00-" + traceID + "-" + spanID + "-01", wantValid: true, wantFlags: 1},
+		{name: "not sampled", header: "00-" + traceID + "-" + spanID + "-00", wantValid: true},
+		{name: "later version", header: "01-" + traceID + "-" + spanID + "-01", wantValid: true, wantFlags: 1},
+		{name: "later version with more fields", header: "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", wantValid: true, wantFlags: 1},
+		{name: "version 00 with more fields", header: "00-" + traceID + "-" + spanID + "-01-extra"},
+		{name: "version ff", header: "ff-" + traceID + "-" + spanID + "-01"},
+		{name: "version not hex", header: "0x-" + traceID + "-" + spanID + "-01"},
+		{name: "version too long", header: "000-" + traceID + "-" + spanID + "-01"},
+		{name: "zero trace id", header: "00-00000000000000000000000000000000-" + spanID + "-01"},
+		{name: "zero span id", header: "00-" + traceID + "-0000000000000000-01"},
+		{name: "uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"},
+		{name: "short trace id", header: "00-" + traceID[1:] + "-" + spanID + "-01"},
+		{name: "long span id", header: "00-" + traceID + "-" + spanID + "0-01"},
+		{name: "short flags", header: "00-" + traceID + "-" + spanID + "-1"},
+		{name: "flags not hex", header: "00-" + traceID + "-" + spanID + "-zz"},
+		{name: "missing fields", header: "00-" + traceID},
+		{name: "empty", header: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := tracecontext.Parse(tt.header)
+			if !tt.wantValid {
+				if !errors.Is(err, tracecontext.ErrInvalidTraceParent) {
+					t.Errorf("Parse = %v, want %v", err, tracecontext.ErrInvalidTraceParent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tp.TraceIDString() != traceID || tp.SpanIDString() != spanID || tp.Flags != tt.wantFlags {
+				t.Errorf("Parse = %s", tp)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tp := tracecontext.New()
+	parsed, err := tracecontext.Parse(tp.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != tp {
+		t.Errorf("Parse(%s) = %s", tp, parsed)
+	}
+
+	child := tp.Child()
+	if child.TraceID != tp.TraceID || child.SpanID == tp.SpanID {
+		t.Errorf("child %s of %s", child, tp)
+	}
+}
+
+// the producer interceptor writes the headers the consumer middleware continues
+func TestKafkaPropagation(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	writer := producer.Intercept(broker.Writer("orders"), producer.TraceParent())
+
+	parent := tracecontext.New()
+	parent.State = "vendor=1"
+	if err := writer.WriteMessages(tracecontext.ContextWith(context.Background(), parent), kafka.Message{Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	written := broker.ExpectMessage(t, "orders", func(kafka.Message) bool { return true })
+	header, ok := consumer.Header(written, tracecontext.HeaderTraceParent)
+	if !ok {
+		t.Fatal("no traceparent header written")
+	}
+	sent, err := tracecontext.Parse(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.TraceID != parent.TraceID || sent.SpanID == parent.SpanID {
+		t.Errorf("written span %s of parent %s", sent, parent)
+	}
+
+	spans := make(chan tracecontext.TraceParent, 1)
+	c, err := consumer.NewConsumer(
+		consumer.Config{Brokers: []string{"kafkatest"}, GroupID: "orders-service", Topics: []string{"orders"}},
+		consumer.HandlerFunc(func(ctx context.Context, _ kafka.Message) error {
+			span, _ := tracecontext.FromContext(ctx)
+			spans <- span
+			return nil
+		}),
+		consumer.WithReader(broker.Reader("orders-service", "orders")),
+		consumer.WithMiddleware(consumer.TraceParent()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case span := <-spans:
+		if span.TraceID != parent.TraceID || span.SpanID == sent.SpanID || span.State != parent.State {
+			t.Errorf("handled span %s state %q, written %s", span, span.State, sent)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not handled")
+	}
+}
@@ -0,0 +1,72 @@
+package log
+
+import "context"
+
+type ctxKey int
+
+const (
+	fieldsCtxKey ctxKey = iota
+	debugCtxKey
+	loggerCtxKey
+)
+
+// ContextWithFields returns a copy of ctx carrying fld merged over the fields
+// already stored in ctx, the parent context is never modified.
+func ContextWithFields(ctx context.Context, fld Fld) context.Context {
+	parent := fieldsFromContext(ctx)
+	merged := make(Fld, len(parent)+len(fld))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range fld {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, fieldsCtxKey, merged)
+}
+
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return ContextWithFields(ctx, Fld{RequestIDField: requestID})
+}
+
+// ContextWithDebug enables Debug lines for loggers derived with WithCtx
+func ContextWithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugCtxKey, true)
+}
+
+// ContextWithLogger stores l to be returned by FromContext
+func ContextWithLogger(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, loggerCtxKey, l)
+}
+
+// FromContext returns the logger stored in ctx (or the default one) with ctx fields applied
+func FromContext(ctx context.Context) *Log {
+	l, ok := ctx.Value(loggerCtxKey).(*Log)
+	if !ok || l == nil {
+		l = glog
+	}
+	return l.WithCtx(ctx)
+}
+
+// RequestIDFromContext returns the request id set by ContextWithRequestID or the legacy _request_id key
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := fieldsFromContext(ctx)[RequestIDField].(string); ok {
+		return id
+	}
+	id, _ := ctx.Value(RequestIDField).(string)
+	return id
+}
+
+func fieldsFromContext(ctx context.Context) Fld {
+	fld, _ := ctx.Value(fieldsCtxKey).(Fld)
+	return fld
+}
+
+// DebugFromContext reports whether ContextWithDebug or the legacy _debug key is set
+func DebugFromContext(ctx context.Context) bool {
+	if v, ok := ctx.Value(debugCtxKey).(bool); ok && v {
+		return true
+	}
+	// compatibility with context.WithValue(ctx, "_debug", ...)
+	return ctx.Value(DebugField) != nil
+}
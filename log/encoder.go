@@ -0,0 +1,74 @@
+package log
+
+import (
+	"fmt"
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+	EncodingLogfmt  = "logfmt"
+
+	ServiceField = "_service"
+)
+
+func newEncoder(cfg Config) (zapcore.Encoder, error) {
+	encCfg := defaultEncoderConfig()
+	if cfg.MessageKey != "" {
+		encCfg.MessageKey = cfg.MessageKey
+	}
+	if cfg.LevelKey != "" {
+		encCfg.LevelKey = cfg.LevelKey
+	}
+	if cfg.TimeKey != "" {
+		encCfg.TimeKey = cfg.TimeKey
+	}
+	if cfg.CallerKey != "" {
+		encCfg.CallerKey = cfg.CallerKey
+	}
+	if cfg.TimeFormat != "" {
+		encCfg.EncodeTime = timeEncoder(cfg.TimeFormat)
+	}
+
+	switch cfg.Encoding {
+	case "", EncodingJSON:
+		return zapcore.NewJSONEncoder(encCfg), nil
+	case EncodingConsole:
+		return zapcore.NewConsoleEncoder(encCfg), nil
+	case EncodingLogfmt:
+		return zaplogfmt.NewEncoder(encCfg), nil
+	default:
+		return nil, fmt.Errorf("unknown log encoding %q", cfg.Encoding)
+	}
+}
+
+// timeEncoder accepts zap's named formats (iso8601, rfc3339, rfc3339nano,
+// epoch, millis, nanos) and falls back to a time.Format layout otherwise.
+func timeEncoder(format string) zapcore.TimeEncoder {
+	switch format {
+	case "rfc3339nano", "RFC3339Nano", "rfc3339", "RFC3339", "iso8601", "ISO8601", "epoch", "millis", "nanos":
+		var enc zapcore.TimeEncoder
+		_ = enc.UnmarshalText([]byte(format))
+		return enc
+	default:
+		return zapcore.TimeEncoderOfLayout(format)
+	}
+}
+
+func staticFields(cfg Config) []zapcore.Field {
+	fields := make([]zapcore.Field, 0, len(cfg.StaticFields)+2)
+	if cfg.ServiceName != "" {
+		fields = append(fields, zap.String(ServiceField, cfg.ServiceName))
+	}
+	if cfg.Version != "" {
+		fields = append(fields, zap.String(VersionField, cfg.Version))
+	}
+	for k, v := range cfg.StaticFields {
+		fields = append(fields, zap.Any(k, v))
+	}
+
+	return fields
+}
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func encode(t *testing.T, cfg Config, fields ...zapcore.Field) string {
+	t.Helper()
+	enc, err := newEncoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := zapcore.Entry{
+		Level:   zapcore.InfoLevel,
+		Time:    time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Message: "hello",
+	}
+	buf, err := enc.EncodeEntry(entry, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Free()
+	return strings.TrimSpace(buf.String())
+}
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "json by default",
+			cfg:  Config{},
+			want: `{"level":"INFO","time":"2024-05-01T12:30:00.000Z","message":"hello","k":"v"}`,
+		},
+		{
+			name: "json keys",
+			cfg:  Config{Encoding: EncodingJSON, MessageKey: "msg", LevelKey: "lvl", TimeKey: "ts"},
+			want: `{"lvl":"INFO","ts":"2024-05-01T12:30:00.000Z","msg":"hello","k":"v"}`,
+		},
+		{
+			name: "console",
+			cfg:  Config{Encoding: EncodingConsole},
+			want: "2024-05-01T12:30:00.000Z\tINFO\thello\t{\"k\": \"v\"}",
+		},
+		{
+			name: "logfmt",
+			cfg:  Config{Encoding: EncodingLogfmt},
+			want: "time=2024-05-01T12:30:00.000Z level=INFO message=hello k=v",
+		},
+		{
+			name: "named time format",
+			cfg:  Config{TimeFormat: "epoch"},
+			want: `{"level":"INFO","time":1714566600,"message":"hello","k":"v"}`,
+		},
+		{
+			name: "time layout",
+			cfg:  Config{TimeFormat: time.DateTime},
+			want: `{"level":"INFO","time":"2024-05-01 12:30:00","message":"hello","k":"v"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, tt.cfg, zap.String("k", "v")); got != tt.want {
+				t.Errorf("encoded\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEncoderUnknown(t *testing.T) {
+	if _, err := newEncoder(Config{Encoding: "xml"}); err == nil {
+		t.Error("newEncoder = nil error for xml")
+	}
+}
+
+func TestStaticFields(t *testing.T) {
+	cfg := Config{ServiceName: "orders", Version: "1.2.0", StaticFields: Fld{"region": "eu"}}
+	want := `{"level":"INFO","time":"2024-05-01T12:30:00.000Z","message":"hello","_service":"orders","_version":"1.2.0","region":"eu"}`
+	if got := encode(t, cfg, staticFields(cfg)...); got != want {
+		t.Errorf("encoded\n%s\nwant\n%s", got, want)
+	}
+
+	if fields := staticFields(Config{}); len(fields) != 0 {
+		t.Errorf("fields = %v, want none", fields)
+	}
+}
@@ -3,16 +3,56 @@ package log
 import (
 	"errors"
 	"fmt"
+	"runtime"
+	"strings"
 )
 
-type errWithFields interface {
-	Fields() Fld
-	Origin() error
+const (
+	ErrorCodeField     = "error_code"
+	ErrorSeverityField = "error_severity"
+	ErrorStackField    = "error_stack"
+	ErrorChainField    = "error_chain"
+	ErrorKindField     = "error_kind"
+
+	maxStackDepth = 32
+)
+
+type Severity int8
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
 }
 
+// FieldsError carries logging fields along the wrap chain. The stack is captured
+// once at the first wrap, code and severity are inherited by outer wraps.
 type FieldsError struct {
-	err    error
-	fields Fld
+	err      error
+	msg      string
+	fields   Fld
+	stack    []uintptr
+	code     string
+	severity Severity
+	kind     Kind
+	public   *Public
 }
 
 func (e *FieldsError) Error() string {
@@ -23,35 +63,202 @@ func (e *FieldsError) Is(target error) bool {
 	return errors.Is(e.err, target)
 }
 
+func (e *FieldsError) Unwrap() error {
+	return e.err
+}
+
+// Fields returns a copy of the fields merged along the chain, outer wraps win
 func (e *FieldsError) Fields() Fld {
-	return e.fields
+	return mergeFields(e.fields, nil)
 }
 
 func (e *FieldsError) Origin() error {
 	return e.err
 }
 
+func (e *FieldsError) Code() string {
+	return e.code
+}
+
+func (e *FieldsError) Severity() Severity {
+	return e.severity
+}
+
+// StackTrace formats the stack captured at the first wrap
+func (e *FieldsError) StackTrace() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
 // Wrap error with fields for logging
 func Wrap(msg string, err error, fields Fld) error {
-	if fields == nil {
-		fields = Fld{}
-	}
-	fieldsErr, ok := err.(errWithFields)
-	if !ok {
-		return &FieldsError{
-			err:    fmt.Errorf("%s: %w", msg, err),
-			fields: fields,
+	inner := findFieldsError(err)
+	wrapped := &FieldsError{
+		err:    fmt.Errorf("%s: %w", msg, err),
+		msg:    msg,
+		fields: mergeFields(FieldsOf(err), fields),
+	}
+	if inner == nil {
+		wrapped.stack = callers(1)
+		return wrapped
+	}
+
+	wrapped.inherit(inner)
+	return wrapped
+}
+
+// WithCode sets an application error code, err is wrapped without a message if needed
+func WithCode(err error, code string) error {
+	if err == nil {
+		return nil
+	}
+	e := cloneFieldsError(err)
+	e.code = code
+	return e
+}
+
+func WithSeverity(err error, severity Severity) error {
+	if err == nil {
+		return nil
+	}
+	e := cloneFieldsError(err)
+	e.severity = severity
+	return e
+}
+
+// CodeOf returns the code of the outermost FieldsError in the chain
+func CodeOf(err error) string {
+	if e := findFieldsError(err); e != nil {
+		return e.code
+	}
+	return ""
+}
+
+func SeverityOf(err error) Severity {
+	if e := findFieldsError(err); e != nil {
+		return e.severity
+	}
+	return SeverityUnknown
+}
+
+// FieldsOf collects fields of every FieldsError in the tree, including errors.Join branches
+func FieldsOf(err error) Fld {
+	switch e := err.(type) {
+	case nil:
+		return Fld{}
+	case *FieldsError:
+		return mergeFields(e.fields, nil)
+	case interface{ Unwrap() []error }:
+		result := Fld{}
+		for _, inner := range e.Unwrap() {
+			result = mergeFields(result, FieldsOf(inner))
+		}
+		return result
+	default:
+		return FieldsOf(errors.Unwrap(err))
+	}
+}
+
+// Chain returns wrap messages from the outermost to the root cause
+func Chain(err error) []string {
+	chain := make([]string, 0)
+	for err != nil {
+		if e, ok := err.(*FieldsError); ok && e.msg != "" {
+			chain = append(chain, e.msg)
 		}
+		next := errors.Unwrap(err)
+		if next == nil {
+			chain = append(chain, err.Error())
+		}
+		err = next
+	}
+	return chain
+}
+
+// errorFields are the fields Log.WithErr adds besides the error itself
+func errorFields(err error) Fld {
+	fields := FieldsOf(err)
+	e := findFieldsError(err)
+	if e == nil {
+		return fields
 	}
 
-	return &FieldsError{
-		err:    fmt.Errorf("%s: %w", msg, fieldsErr.Origin()),
-		fields: mergeFields(fieldsErr.Fields(), fields),
+	if e.code != "" {
+		fields[ErrorCodeField] = e.code
+	}
+	if e.severity != SeverityUnknown {
+		fields[ErrorSeverityField] = e.severity.String()
+	}
+	if e.kind != KindUnknown {
+		fields[ErrorKindField] = e.kind.String()
+	}
+	if stack := e.StackTrace(); stack != "" {
+		fields[ErrorStackField] = stack
+	}
+	if chain := Chain(err); len(chain) > 1 {
+		fields[ErrorChainField] = chain
 	}
+	return fields
 }
 
+func (e *FieldsError) inherit(inner *FieldsError) {
+	e.stack = inner.stack
+	e.code = inner.code
+	e.severity = inner.severity
+	e.kind = inner.kind
+	e.public = inner.public
+}
+
+func findFieldsError(err error) *FieldsError {
+	var e *FieldsError
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+func cloneFieldsError(err error) *FieldsError {
+	if e, ok := err.(*FieldsError); ok {
+		clone := *e
+		return &clone
+	}
+
+	e := &FieldsError{
+		err:    err,
+		fields: FieldsOf(err),
+	}
+	if inner := findFieldsError(err); inner != nil {
+		e.inherit(inner)
+	} else {
+		e.stack = callers(2)
+	}
+	return e
+}
+
+// callers skips itself and skip frames of the package functions creating the error
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// mergeFields returns a new map, neither argument is modified
 func mergeFields(fld1, fld2 Fld) Fld {
-	result := fld1
+	result := make(Fld, len(fld1)+len(fld2))
+	for k, v := range fld1 {
+		result[k] = v
+	}
 	for k, v := range fld2 {
 		result[k] = v
 	}
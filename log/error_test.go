@@ -0,0 +1,157 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var errRoot = errors.New("root cause")
+
+func wrapHere(err error) error {
+	return Wrap("load order", err, Fld{"order": 1})
+}
+
+func TestWrapCapturesStackOnce(t *testing.T) {
+	inner := wrapHere(errRoot)
+	stack := inner.(*FieldsError).StackTrace()
+	lines := strings.Split(stack, "\n")
+	if !strings.HasSuffix(lines[0], "log.wrapHere") {
+		t.Fatalf("first frame = %q, want the caller of Wrap", lines[0])
+	}
+	if !strings.Contains(stack, "log.TestWrapCapturesStackOnce") {
+		t.Errorf("stack doesn't reach the test:\n%s", stack)
+	}
+
+	outer := WithCode(Wrap("handle", inner, nil), "E42")
+	if got := outer.(*FieldsError).StackTrace(); got != stack {
+		t.Errorf("outer wraps replaced the stack:\n%s", got)
+	}
+
+	coded := WithCode(errRoot, "E1").(*FieldsError).StackTrace()
+	if !strings.HasSuffix(strings.Split(coded, "\n")[0], "log.TestWrapCapturesStackOnce") {
+		t.Errorf("WithCode stack starts at %q, want the test", strings.Split(coded, "\n")[0])
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{name: "nil", err: nil, want: []string{}},
+		{name: "plain", err: errRoot, want: []string{"root cause"}},
+		{
+			name: "wraps",
+			err:  Wrap("handle", fmt.Errorf("decode: %w", wrapHere(errRoot)), nil),
+			want: []string{"handle", "load order", "root cause"},
+		},
+		{
+			name: "code without message",
+			err:  WithCode(wrapHere(errRoot), "E1"),
+			want: []string{"load order", "root cause"},
+		},
+		{
+			name: "join ends the chain with every branch",
+			err:  Wrap("handle", errors.Join(wrapHere(errRoot), errors.New("second")), nil),
+			want: []string{"handle", "load order: root cause\nsecond"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Chain(tt.err); !slices.Equal(got, tt.want) {
+				t.Errorf("Chain = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldsOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Fld
+	}{
+		{name: "nil", err: nil, want: Fld{}},
+		{name: "plain", err: errRoot, want: Fld{}},
+		{
+			name: "outer wrap wins",
+			err:  Wrap("handle", Wrap("load", errRoot, Fld{"id": 1, "shard": 2}), Fld{"id": 3}),
+			want: Fld{"id": 3, "shard": 2},
+		},
+		{
+			name: "through fmt wrap",
+			err:  fmt.Errorf("context: %w", Wrap("load", errRoot, Fld{"id": 1})),
+			want: Fld{"id": 1},
+		},
+		{
+			name: "join branches merged",
+			err:  errors.Join(Wrap("a", errRoot, Fld{"a": 1}), errRoot, Wrap("b", errRoot, Fld{"b": 2})),
+			want: Fld{"a": 1, "b": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FieldsOf(tt.err); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("FieldsOf = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorFieldsImmutable(t *testing.T) {
+	fields := Fld{"id": 1}
+	inner := Wrap("load", errRoot, fields)
+	fields["id"] = 2
+
+	outer := Wrap("handle", inner, Fld{"user": "alice"})
+	coded := WithSeverity(WithCode(outer, "E1"), SeverityCritical)
+
+	// maps handed out are copies, the logger adds the error to its own
+	FieldsOf(inner)["id"] = 3
+	inner.(*FieldsError).Fields()["id"] = 4
+	logged := errorFields(coded)
+	logged["error"] = coded
+
+	if got := FieldsOf(inner); fmt.Sprint(got) != fmt.Sprint(Fld{"id": 1}) {
+		t.Errorf("inner fields = %v", got)
+	}
+	if got := FieldsOf(outer); fmt.Sprint(got) != fmt.Sprint(Fld{"id": 1, "user": "alice"}) {
+		t.Errorf("outer fields = %v", got)
+	}
+	if CodeOf(outer) != "" || SeverityOf(outer) != SeverityUnknown {
+		t.Errorf("WithCode and WithSeverity changed the wrapped error: %q, %s", CodeOf(outer), SeverityOf(outer))
+	}
+	if _, ok := FieldsOf(coded)["error"]; ok {
+		t.Error("errorFields result shares the error's fields")
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	err := WithSeverity(WithCode(Wrap("handle", wrapHere(errRoot), Fld{"user": "alice"}), "E1"), SeverityWarning)
+	fields := errorFields(err)
+
+	for key, want := range map[string]any{
+		"order":            1,
+		"user":             "alice",
+		ErrorCodeField:     "E1",
+		ErrorSeverityField: "warning",
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %v", key, fields[key], want)
+		}
+	}
+	if chain, _ := fields[ErrorChainField].([]string); !slices.Equal(chain, []string{"handle", "load order", "root cause"}) {
+		t.Errorf("%s = %v", ErrorChainField, fields[ErrorChainField])
+	}
+	if stack, _ := fields[ErrorStackField].(string); !strings.Contains(stack, "log.wrapHere") {
+		t.Errorf("%s = %v", ErrorStackField, fields[ErrorStackField])
+	}
+
+	if fields := errorFields(errRoot); len(fields) != 0 {
+		t.Errorf("plain error fields = %v", fields)
+	}
+}
@@ -0,0 +1,228 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	megabyte         = 1024 * 1024
+)
+
+var (
+	filesMu sync.Mutex
+	files   = make(map[*FileWriter]struct{})
+)
+
+// FileRotation describes built-in rotation, zero values disable the limit
+type FileRotation struct {
+	MaxSizeMB  int
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// FileWriter is a zapcore.WriteSyncer over a file which can be reopened on
+// SIGHUP (logrotate copy/move mode) and optionally rotates itself by size.
+type FileWriter struct {
+	path     string
+	rotation FileRotation
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileWriter(path string, rotation FileRotation) (*FileWriter, error) {
+	w := &FileWriter{
+		path:     path,
+		rotation: rotation,
+	}
+	f, size, err := w.openFile()
+	if err != nil {
+		return nil, err
+	}
+	w.file, w.size = f, size
+
+	filesMu.Lock()
+	files[w] = struct{}{}
+	filesMu.Unlock()
+
+	return w, nil
+}
+
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	maxSize := int64(w.rotation.MaxSizeMB) * megabyte
+	if maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *FileWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Sync()
+}
+
+// Reopen opens the path again and closes the previous file, so writes go to a
+// fresh file after logrotate has moved the old one away. A failed open keeps
+// the current file in place.
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	f, size, err := w.openFile()
+	if err != nil {
+		return err
+	}
+	old := w.file
+	w.file, w.size = f, size
+	return old.Close()
+}
+
+func (w *FileWriter) Close() error {
+	filesMu.Lock()
+	delete(files, w)
+	filesMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+func (w *FileWriter) openFile() (*os.File, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, errors.Join(err, f.Close())
+	}
+	return f, info.Size(), nil
+}
+
+// rotate renames the open file before reopening the path, so a failed rename or
+// open leaves the current file in place and writes go on
+func (w *FileWriter) rotate() error {
+	prefix, ext := w.backupName()
+	backup := fmt.Sprintf("%s%s%s", prefix, time.Now().Format(backupTimeFormat), ext)
+	if err := os.Rename(w.path, backup); err != nil {
+		return err
+	}
+	f, size, err := w.openFile()
+	if err != nil {
+		return err
+	}
+	old := w.file
+	w.file, w.size = f, size
+	if err := old.Close(); err != nil {
+		return errors.Join(err, w.cleanup())
+	}
+
+	return w.cleanup()
+}
+
+// cleanup removes backups beyond MaxBackups and older than MaxAge
+func (w *FileWriter) cleanup() error {
+	if w.rotation.MaxBackups <= 0 && w.rotation.MaxAge <= 0 {
+		return nil
+	}
+	prefix, ext := w.backupName()
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+
+	// the glob also matches other files, e.g. app-audit.log for app.log, only
+	// names with a backup timestamp are touched
+	type backupFile struct {
+		path string
+		ts   time.Time
+	}
+	backups := make([]backupFile, 0, len(matches))
+	for _, match := range matches {
+		ts, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: match, ts: ts})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ts.After(backups[j].ts)
+	})
+
+	var errs error
+	for i, backup := range backups {
+		expired := w.rotation.MaxBackups > 0 && i >= w.rotation.MaxBackups
+		if w.rotation.MaxAge > 0 && time.Since(backup.ts) > w.rotation.MaxAge {
+			expired = true
+		}
+		if expired {
+			errs = errors.Join(errs, os.Remove(backup.path))
+		}
+	}
+
+	return errs
+}
+
+func (w *FileWriter) backupName() (string, string) {
+	ext := filepath.Ext(w.path)
+	return strings.TrimSuffix(w.path, ext) + "-", ext
+}
+
+// ReopenFiles reopens every file opened by the package, it is called on SIGHUP
+func ReopenFiles() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	var errs error
+	for w := range files {
+		errs = errors.Join(errs, w.Reopen())
+	}
+	return errs
+}
+
+func openOutputs(paths []string, rotation FileRotation) (zapcore.WriteSyncer, []*FileWriter, error) {
+	syncers := make([]zapcore.WriteSyncer, 0, len(paths))
+	opened := make([]*FileWriter, 0, len(paths))
+	for _, path := range paths {
+		switch path {
+		case "stdout":
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case "stderr":
+			syncers = append(syncers, zapcore.Lock(os.Stderr))
+		default:
+			w, err := NewFileWriter(path, rotation)
+			if err != nil {
+				for _, o := range opened {
+					_ = o.Close()
+				}
+				return nil, nil, err
+			}
+			syncers = append(syncers, w)
+			opened = append(opened, w)
+		}
+	}
+
+	return zapcore.NewMultiWriteSyncer(syncers...), opened, nil
+}
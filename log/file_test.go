@@ -0,0 +1,167 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileWriterCleanup(t *testing.T) {
+	now := time.Now()
+	backup := func(age time.Duration) string {
+		return "app-" + now.Add(-age).Format(backupTimeFormat) + ".log"
+	}
+
+	tests := []struct {
+		name     string
+		rotation FileRotation
+		files    []string
+		want     []string
+	}{
+		{
+			name:     "keeps MaxBackups newest",
+			rotation: FileRotation{MaxBackups: 2},
+			files:    []string{backup(time.Minute), backup(time.Hour), backup(2 * time.Hour)},
+			want:     []string{backup(time.Minute), backup(time.Hour)},
+		},
+		{
+			name:     "removes backups older than MaxAge",
+			rotation: FileRotation{MaxAge: 90 * time.Minute},
+			files:    []string{backup(time.Minute), backup(time.Hour), backup(2 * time.Hour)},
+			want:     []string{backup(time.Minute), backup(time.Hour)},
+		},
+		{
+			name:     "applies both limits",
+			rotation: FileRotation{MaxBackups: 2, MaxAge: 30 * time.Minute},
+			files:    []string{backup(time.Minute), backup(time.Hour), backup(2 * time.Hour)},
+			want:     []string{backup(time.Minute)},
+		},
+		{
+			name:     "ignores files without a backup timestamp",
+			rotation: FileRotation{MaxBackups: 1, MaxAge: time.Minute},
+			files:    []string{"app-audit.log", "app-2.log", "app-.log", backup(time.Hour), backup(2 * time.Hour)},
+			want:     []string{"app-.log", "app-2.log", "app-audit.log"},
+		},
+		{
+			name:  "no limits",
+			files: []string{"app-audit.log", backup(time.Hour)},
+			want:  []string{"app-audit.log", backup(time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := &FileWriter{path: filepath.Join(dir, "app.log"), rotation: tt.rotation}
+			if err := w.cleanup(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := listDir(t, dir)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFileWriterRotate(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewFileWriter(filepath.Join(dir, "app.log"), FileRotation{MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := []byte(strings.Repeat("x", megabyte/2) + "\n")
+	for range 3 {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := listDir(t, dir)
+	if len(files) != 2 || files[1] != "app.log" {
+		t.Fatalf("files = %v, want one backup and app.log", files)
+	}
+	info, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(line)) {
+		t.Errorf("app.log size = %d, want %d", info.Size(), len(line))
+	}
+}
+
+func TestFileWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(path, FileRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first\n")
+
+	// logrotate moved the file away, a directory in its place makes the open fail
+	moved := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err == nil {
+		t.Fatal("Reopen = nil with a directory at the path")
+	}
+	write("second\n")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	write("third\n")
+
+	for name, want := range map[string]string{moved: "first\nsecond\n", path: "third\n"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,53 @@
+package grpclog
+
+import (
+	"context"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor forwards the request id and debug flag from ctx to the
+// outgoing metadata and logs the finished call through Log.LogGRPC.
+func UnaryClientInterceptor(l *log.Log, opts ...Option) grpc.UnaryClientInterceptor {
+	o := evaluateOptions(opts)
+	logInterceptor := logging.UnaryClientInterceptor(loggerFunc(l), o.loggingOpts...)
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		return logInterceptor(clientContext(ctx), method, req, reply, cc, invoker, callOpts...)
+	}
+}
+
+func StreamClientInterceptor(l *log.Log, opts ...Option) grpc.StreamClientInterceptor {
+	o := evaluateOptions(opts)
+	logInterceptor := logging.StreamClientInterceptor(loggerFunc(l), o.loggingOpts...)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return logInterceptor(clientContext(ctx), desc, cc, method, streamer, callOpts...)
+	}
+}
+
+// clientContext sets headers only when they are absent, a request id already in
+// the outgoing metadata is kept and becomes the request id of ctx
+func clientContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	requestID := log.RequestIDFromContext(ctx)
+	if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+		if requestID == "" {
+			ctx = log.ContextWithRequestID(ctx, ids[0])
+		}
+	} else {
+		if requestID == "" {
+			requestID = uuid.New().String()
+			ctx = log.ContextWithRequestID(ctx, requestID)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIDHeader, requestID)
+	}
+	if log.DebugFromContext(ctx) && len(md.Get(DebugHeader)) == 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, DebugHeader, "1")
+	}
+
+	return ctx
+}
@@ -0,0 +1,86 @@
+package grpclog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MikhailGulkin/packages/log"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestClientContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		ctx           func() context.Context
+		wantRequestID string
+		// wantCtxID is wantRequestID when empty
+		wantCtxID string
+		wantDebug int
+	}{
+		{
+			name:          "request id from ctx",
+			ctx:           func() context.Context { return log.ContextWithRequestID(context.Background(), "ctx-id") },
+			wantRequestID: "ctx-id",
+		},
+		{
+			name: "request id already in metadata",
+			ctx: func() context.Context {
+				ctx := log.ContextWithRequestID(context.Background(), "ctx-id")
+				return metadata.AppendToOutgoingContext(ctx, RequestIDHeader, "md-id")
+			},
+			wantRequestID: "md-id",
+			wantCtxID:     "ctx-id",
+		},
+		{
+			name: "request id in metadata without ctx",
+			ctx: func() context.Context {
+				return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(RequestIDHeader, "md-id"))
+			},
+			wantRequestID: "md-id",
+		},
+		{
+			name: "debug flag once",
+			ctx: func() context.Context {
+				ctx := log.ContextWithDebug(log.ContextWithRequestID(context.Background(), "ctx-id"))
+				return metadata.AppendToOutgoingContext(ctx, DebugHeader, "1")
+			},
+			wantRequestID: "ctx-id",
+			wantDebug:     1,
+		},
+		{
+			name: "debug flag from ctx",
+			ctx: func() context.Context {
+				return log.ContextWithDebug(log.ContextWithRequestID(context.Background(), "ctx-id"))
+			},
+			wantRequestID: "ctx-id",
+			wantDebug:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := clientContext(tt.ctx())
+			md, _ := metadata.FromOutgoingContext(ctx)
+
+			ids := md.Get(RequestIDHeader)
+			if len(ids) != 1 || ids[0] != tt.wantRequestID {
+				t.Errorf("%s = %v, want [%s]", RequestIDHeader, ids, tt.wantRequestID)
+			}
+			wantCtxID := tt.wantCtxID
+			if wantCtxID == "" {
+				wantCtxID = tt.wantRequestID
+			}
+			if got := log.RequestIDFromContext(ctx); got != wantCtxID {
+				t.Errorf("ctx request id = %q, want %q", got, wantCtxID)
+			}
+			if got := len(md.Get(DebugHeader)); got != tt.wantDebug {
+				t.Errorf("%s values = %d, want %d", DebugHeader, got, tt.wantDebug)
+			}
+		})
+	}
+
+	ctx := clientContext(context.Background())
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if ids := md.Get(RequestIDHeader); len(ids) != 1 || ids[0] != log.RequestIDFromContext(ctx) || ids[0] == "" {
+		t.Errorf("generated request id: metadata %v, ctx %q", ids, log.RequestIDFromContext(ctx))
+	}
+}
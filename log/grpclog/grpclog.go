@@ -0,0 +1,72 @@
+package grpclog
+
+import (
+	"context"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RequestIDHeader = "x-request-id"
+	DebugHeader     = "x-debug"
+)
+
+type Option func(*options)
+
+type options struct {
+	loggingOpts []logging.Option
+}
+
+func evaluateOptions(opts []Option) *options {
+	o := &options{
+		loggingOpts: []logging.Option{
+			logging.WithLogOnEvents(logging.FinishCall),
+			logging.WithCodes(Code),
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLoggingOptions passes options to the go-grpc-middleware logging interceptor,
+// by default only finished calls are logged.
+func WithLoggingOptions(opts ...logging.Option) Option {
+	return func(o *options) {
+		o.loggingOpts = append(o.loggingOpts, opts...)
+	}
+}
+
+type callErrorCtxKey struct{}
+
+// callError keeps the handler error before it is converted to a status,
+// so the finished call line gets all the FieldsError fields.
+type callError struct {
+	err error
+}
+
+func withCallError(ctx context.Context) (context.Context, *callError) {
+	ce := &callError{}
+	return context.WithValue(ctx, callErrorCtxKey{}, ce), ce
+}
+
+// loggerFunc adapts Log.LogGRPC so every line carries the request context fields
+func loggerFunc(l *log.Log) logging.LoggerFunc {
+	return func(ctx context.Context, lvl logging.Level, msg string, fields ...any) {
+		logger := l.WithCtx(ctx)
+		if ce, ok := ctx.Value(callErrorCtxKey{}).(*callError); ok && ce.err != nil {
+			logger = logger.WithErr(ce.err)
+		}
+		logger.LogGRPC(ctx, lvl, msg, fields...)
+	}
+}
+
+func recoveryHandler(l *log.Log) func(ctx context.Context, p any) error {
+	return func(ctx context.Context, p any) error {
+		l.WithCtx(ctx).LogPanic(p)
+		return status.Error(codes.Internal, codes.Internal.String())
+	}
+}
@@ -0,0 +1,85 @@
+package grpclog
+
+import (
+	"context"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/google/uuid"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+)
+
+// UnaryServerInterceptor puts the request id and debug flag from metadata into ctx,
+// logs the finished call through Log.LogGRPC and turns panics into codes.Internal.
+// Handler errors are logged in full and returned to the client through Status.
+func UnaryServerInterceptor(l *log.Log, opts ...Option) grpc.UnaryServerInterceptor {
+	o := evaluateOptions(opts)
+	logInterceptor := logging.UnaryServerInterceptor(loggerFunc(l), o.loggingOpts...)
+	recoveryInterceptor := recovery.UnaryServerInterceptor(recovery.WithRecoveryHandlerContext(recoveryHandler(l)))
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, requestID := serverContext(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID))
+		ctx, ce := withCallError(ctx)
+
+		resp, err := logInterceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			resp, err := recoveryInterceptor(ctx, req, info, handler)
+			ce.err = err
+			return resp, err
+		})
+		return resp, Error(err)
+	}
+}
+
+func StreamServerInterceptor(l *log.Log, opts ...Option) grpc.StreamServerInterceptor {
+	o := evaluateOptions(opts)
+	logInterceptor := logging.StreamServerInterceptor(loggerFunc(l), o.loggingOpts...)
+	recoveryInterceptor := recovery.StreamServerInterceptor(recovery.WithRecoveryHandlerContext(recoveryHandler(l)))
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, requestID := serverContext(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIDHeader, requestID))
+
+		ctx, ce := withCallError(ctx)
+		wrapped := middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+
+		err := logInterceptor(srv, wrapped, info, func(srv any, stream grpc.ServerStream) error {
+			err := recoveryInterceptor(srv, stream, info, handler)
+			ce.err = err
+			return err
+		})
+		return Error(err)
+	}
+}
+
+func serverContext(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstValue(md, RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	ctx = log.ContextWithRequestID(ctx, requestID)
+	if isTrue(firstValue(md, DebugHeader)) {
+		ctx = log.ContextWithDebug(ctx)
+	}
+
+	return ctx, requestID
+}
+
+// isTrue follows httplog, only values strconv.ParseBool reads as true enable debug
+func isTrue(v string) bool {
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package grpclog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MikhailGulkin/packages/log"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestServerContextDebug(t *testing.T) {
+	tests := []struct {
+		name  string
+		md    metadata.MD
+		debug bool
+	}{
+		{name: "no header", md: metadata.MD{}},
+		{name: "one", md: metadata.Pairs(DebugHeader, "1"), debug: true},
+		{name: "true", md: metadata.Pairs(DebugHeader, "TRUE"), debug: true},
+		{name: "zero", md: metadata.Pairs(DebugHeader, "0")},
+		{name: "false", md: metadata.Pairs(DebugHeader, "false")},
+		{name: "empty", md: metadata.Pairs(DebugHeader, "")},
+		{name: "garbage", md: metadata.Pairs(DebugHeader, "off")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := serverContext(metadata.NewIncomingContext(context.Background(), tt.md))
+			if got := log.DebugFromContext(ctx); got != tt.debug {
+				t.Errorf("debug = %v, want %v", got, tt.debug)
+			}
+		})
+	}
+}
+
+func TestServerContextRequestID(t *testing.T) {
+	ctx, requestID := serverContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "md-id")))
+	if requestID != "md-id" || log.RequestIDFromContext(ctx) != "md-id" {
+		t.Errorf("request id = %q, ctx %q", requestID, log.RequestIDFromContext(ctx))
+	}
+
+	if _, requestID := serverContext(context.Background()); requestID == "" {
+		t.Error("no request id generated")
+	}
+}
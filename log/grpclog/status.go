@@ -0,0 +1,89 @@
+package grpclog
+
+import (
+	"context"
+	"errors"
+	"github.com/MikhailGulkin/packages/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var kindCodes = map[log.Kind]codes.Code{
+	log.KindInvalidArgument:    codes.InvalidArgument,
+	log.KindNotFound:           codes.NotFound,
+	log.KindAlreadyExists:      codes.AlreadyExists,
+	log.KindPermissionDenied:   codes.PermissionDenied,
+	log.KindUnauthenticated:    codes.Unauthenticated,
+	log.KindFailedPrecondition: codes.FailedPrecondition,
+	log.KindResourceExhausted:  codes.ResourceExhausted,
+	log.KindCanceled:           codes.Canceled,
+	log.KindDeadlineExceeded:   codes.DeadlineExceeded,
+	log.KindUnavailable:        codes.Unavailable,
+	log.KindUnimplemented:      codes.Unimplemented,
+	log.KindInternal:           codes.Internal,
+}
+
+// Code maps err to a gRPC code using its log.Kind, context errors and
+// status errors are respected, anything else is codes.Internal.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if kind := log.KindOf(err); kind != log.KindUnknown {
+		return kindCodes[kind]
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+// Status converts err to a status safe for clients: the message is the public one
+// (or the code name), log.CodeOf and public details go to an ErrorInfo detail.
+// Status errors created by handlers are returned untouched, a wrapped one keeps
+// only its code, the message of the wrap chain may have internal details.
+func Status(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	if se, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return se.GRPCStatus()
+	}
+
+	code := Code(err)
+	public := log.PublicOf(err)
+	msg := public.Message
+	if msg == "" {
+		msg = code.String()
+	}
+	s := status.New(code, msg)
+
+	reason := log.CodeOf(err)
+	if reason == "" && len(public.Details) == 0 {
+		return s
+	}
+	withDetails, detailsErr := s.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Metadata: public.Details,
+	})
+	if detailsErr != nil {
+		return s
+	}
+	return withDetails
+}
+
+// Error is Status(err).Err()
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return Status(err).Err()
+}
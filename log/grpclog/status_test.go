@@ -0,0 +1,100 @@
+package grpclog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MikhailGulkin/packages/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatus(t *testing.T) {
+	secret := log.Fld{"password": "hunter2"}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   codes.Code
+		wantMsg    string
+		wantReason string
+	}{
+		{
+			name:     "plain error",
+			err:      errors.New("db: connection refused"),
+			wantCode: codes.Internal,
+			wantMsg:  "Internal",
+		},
+		{
+			name:     "status error untouched",
+			err:      status.Error(codes.NotFound, "user not found"),
+			wantCode: codes.NotFound,
+			wantMsg:  "user not found",
+		},
+		{
+			name:     "wrapped status error keeps only the code",
+			err:      log.Wrap("load user", status.Error(codes.NotFound, "user 42 not found"), secret),
+			wantCode: codes.NotFound,
+			wantMsg:  "NotFound",
+		},
+		{
+			name:     "wrapped status error with public message",
+			err:      log.WithPublic(log.Wrap("load user", status.Error(codes.NotFound, "user 42"), secret), "user not found", nil),
+			wantCode: codes.NotFound,
+			wantMsg:  "user not found",
+		},
+		{
+			name:     "fmt wrapped status error",
+			err:      fmt.Errorf("call billing: %w", status.Error(codes.Unavailable, "billing at 10.0.0.1 is down")),
+			wantCode: codes.Unavailable,
+			wantMsg:  "Unavailable",
+		},
+		{
+			name:     "kind overrides the status code",
+			err:      log.WithKind(log.Wrap("check", status.Error(codes.Internal, "boom"), secret), log.KindPermissionDenied),
+			wantCode: codes.PermissionDenied,
+			wantMsg:  "PermissionDenied",
+		},
+		{
+			name:       "code goes to ErrorInfo",
+			err:        log.WithCode(log.WithKind(errors.New("exists"), log.KindAlreadyExists), "USER_EXISTS"),
+			wantCode:   codes.AlreadyExists,
+			wantMsg:    "AlreadyExists",
+			wantReason: "USER_EXISTS",
+		},
+		{
+			name:     "context deadline",
+			err:      fmt.Errorf("query: %w", context.DeadlineExceeded),
+			wantCode: codes.DeadlineExceeded,
+			wantMsg:  "DeadlineExceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Status(tt.err)
+			if s.Code() != tt.wantCode {
+				t.Errorf("code = %s, want %s", s.Code(), tt.wantCode)
+			}
+			if s.Message() != tt.wantMsg {
+				t.Errorf("message = %q, want %q", s.Message(), tt.wantMsg)
+			}
+
+			var reason string
+			for _, d := range s.Details() {
+				if info, ok := d.(*errdetails.ErrorInfo); ok {
+					reason = info.Reason
+				}
+			}
+			if reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+
+	if Status(nil) != nil {
+		t.Error("Status(nil) is not nil")
+	}
+}
@@ -0,0 +1,72 @@
+package httplog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MikhailGulkin/packages/log"
+	"net/http"
+)
+
+var kindStatuses = map[log.Kind]int{
+	log.KindInvalidArgument:    http.StatusBadRequest,
+	log.KindNotFound:           http.StatusNotFound,
+	log.KindAlreadyExists:      http.StatusConflict,
+	log.KindPermissionDenied:   http.StatusForbidden,
+	log.KindUnauthenticated:    http.StatusUnauthorized,
+	log.KindFailedPrecondition: http.StatusPreconditionFailed,
+	log.KindResourceExhausted:  http.StatusTooManyRequests,
+	// nginx's "client closed request", there is no standard code for it
+	log.KindCanceled:         499,
+	log.KindDeadlineExceeded: http.StatusGatewayTimeout,
+	log.KindUnavailable:      http.StatusServiceUnavailable,
+	log.KindUnimplemented:    http.StatusNotImplemented,
+	log.KindInternal:         http.StatusInternalServerError,
+}
+
+// StatusCode maps err to an HTTP status using its log.Kind
+func StatusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if kind := log.KindOf(err); kind != log.KindUnknown {
+		return kindStatuses[kind]
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return kindStatuses[log.KindCanceled]
+	case errors.Is(err, context.DeadlineExceeded):
+		return kindStatuses[log.KindDeadlineExceeded]
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// NewErrorResponse builds the sanitized body: the public message (or the status
+// text), log.CodeOf and public details, err.Error() is never exposed.
+func NewErrorResponse(err error) ErrorResponse {
+	public := log.PublicOf(err)
+	msg := public.Message
+	if msg == "" {
+		msg = http.StatusText(StatusCode(err))
+	}
+
+	return ErrorResponse{
+		Error:   msg,
+		Code:    log.CodeOf(err),
+		Details: public.Details,
+	}
+}
+
+// WriteError writes the sanitized error as JSON with the mapped status
+func WriteError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(StatusCode(err))
+	_ = json.NewEncoder(w).Encode(NewErrorResponse(err))
+}
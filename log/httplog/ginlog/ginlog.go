@@ -0,0 +1,34 @@
+// Package ginlog is its own module, so only services using gin depend on it.
+package ginlog
+
+import (
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/MikhailGulkin/packages/log/httplog"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// Middleware is the gin adapter for httplog.Middleware
+func Middleware(l *log.Log, opts ...httplog.Option) gin.HandlerFunc {
+	m := httplog.NewMiddleware(l, opts...)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Request = m.WithRequestContext(c.Writer, c.Request)
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				m.LogPanic(c.Request, p)
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+			// gin reports -1 until the body is written
+			m.LogRequest(c.Request, c.Writer.Status(), max(c.Writer.Size(), 0), time.Since(start))
+		}()
+
+		c.Next()
+	}
+}
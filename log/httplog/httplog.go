@@ -0,0 +1,211 @@
+package httplog
+
+import (
+	"bufio"
+	"errors"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	DebugHeader     = "X-Debug"
+	DebugQueryParam = "debug"
+)
+
+type Option func(*options)
+
+type options struct {
+	debugHeader string
+	debugQuery  string
+	skipPaths   map[string]struct{}
+}
+
+// WithDebugHeader changes the header enabling per-request debug, empty disables it
+func WithDebugHeader(name string) Option {
+	return func(o *options) {
+		o.debugHeader = name
+	}
+}
+
+// WithDebugQueryParam changes the query flag enabling per-request debug, empty disables it
+func WithDebugQueryParam(name string) Option {
+	return func(o *options) {
+		o.debugQuery = name
+	}
+}
+
+// WithSkipPaths disables access logs for paths like health checks
+func WithSkipPaths(paths ...string) Option {
+	return func(o *options) {
+		for _, p := range paths {
+			o.skipPaths[p] = struct{}{}
+		}
+	}
+}
+
+type Middleware struct {
+	logger *log.Log
+	opts   options
+}
+
+func NewMiddleware(l *log.Log, opts ...Option) *Middleware {
+	o := options{
+		debugHeader: DebugHeader,
+		debugQuery:  DebugQueryParam,
+		skipPaths:   make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Middleware{
+		logger: l,
+		opts:   o,
+	}
+}
+
+// Handler wraps next for net/http servers
+func Handler(l *log.Log, next http.Handler, opts ...Option) http.Handler {
+	return NewMiddleware(l, opts...).Handler(next)
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r = m.WithRequestContext(w, r)
+		rw := &responseWriter{ResponseWriter: w}
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				m.LogPanic(r, p)
+				if !rw.wroteHeader {
+					rw.WriteHeader(http.StatusInternalServerError)
+				}
+			}
+			m.LogRequest(r, rw.Status(), rw.bytes, time.Since(start))
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// WithRequestContext reads or generates X-Request-ID, echoes it back and
+// stores it with the debug flag in the request context.
+func (m *Middleware) WithRequestContext(w http.ResponseWriter, r *http.Request) *http.Request {
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	w.Header().Set(RequestIDHeader, requestID)
+
+	ctx := log.ContextWithRequestID(r.Context(), requestID)
+	if m.isDebug(r) {
+		ctx = log.ContextWithDebug(ctx)
+	}
+
+	return r.WithContext(ctx)
+}
+
+func (m *Middleware) LogRequest(r *http.Request, status, bytes int, latency time.Duration) {
+	if _, ok := m.opts.skipPaths[r.URL.Path]; ok {
+		return
+	}
+
+	keysAndValues := []interface{}{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", status,
+		"bytes", bytes,
+		"latency", latency,
+	}
+	l := m.logger.WithCtx(r.Context())
+	if status >= http.StatusInternalServerError {
+		l.Errorw("http request", keysAndValues...)
+		return
+	}
+	l.Infow("http request", keysAndValues...)
+}
+
+func (m *Middleware) LogPanic(r *http.Request, recovered interface{}) {
+	m.logger.WithCtx(r.Context()).LogPanic(recovered)
+}
+
+func (m *Middleware) isDebug(r *http.Request) bool {
+	if m.opts.debugHeader != "" && isTrue(r.Header.Get(m.opts.debugHeader)) {
+		return true
+	}
+	if m.opts.debugQuery != "" && r.URL.Query().Has(m.opts.debugQuery) {
+		v := r.URL.Query().Get(m.opts.debugQuery)
+		return v == "" || isTrue(v)
+	}
+	return false
+}
+
+func isTrue(v string) bool {
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// responseWriter records status and size, Hijack keeps websocket upgrades working
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	if !w.wroteHeader {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+	w.status = http.StatusSwitchingProtocols
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,61 @@
+package httplog
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MikhailGulkin/packages/log"
+)
+
+func TestIsTrue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{"1", true},
+		{"true", true},
+		{"TRUE", true},
+		{"t", true},
+		{"0", false},
+		{"false", false},
+		{"off", false},
+		{"no", false},
+		{"disabled", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		if got := isTrue(tt.value); got != tt.want {
+			t.Errorf("isTrue(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareIsDebug(t *testing.T) {
+	m := NewMiddleware(log.Default())
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   bool
+	}{
+		{name: "none", target: "/", want: false},
+		{name: "header true", target: "/", header: "1", want: true},
+		{name: "header off", target: "/", header: "off", want: false},
+		{name: "query flag", target: "/?debug", want: true},
+		{name: "query true", target: "/?debug=true", want: true},
+		{name: "query garbage", target: "/?debug=yes-please", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set(DebugHeader, tt.header)
+			}
+			if got := m.isDebug(r); got != tt.want {
+				t.Errorf("isDebug = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package log
+
+// Kind is a transport-neutral error class, grpclog and httplog map it to
+// status codes.
+type Kind uint8
+
+const (
+	KindUnknown Kind = iota
+	KindInvalidArgument
+	KindNotFound
+	KindAlreadyExists
+	KindPermissionDenied
+	KindUnauthenticated
+	KindFailedPrecondition
+	KindResourceExhausted
+	KindCanceled
+	KindDeadlineExceeded
+	KindUnavailable
+	KindUnimplemented
+	KindInternal
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindInvalidArgument:
+		return "invalid_argument"
+	case KindNotFound:
+		return "not_found"
+	case KindAlreadyExists:
+		return "already_exists"
+	case KindPermissionDenied:
+		return "permission_denied"
+	case KindUnauthenticated:
+		return "unauthenticated"
+	case KindFailedPrecondition:
+		return "failed_precondition"
+	case KindResourceExhausted:
+		return "resource_exhausted"
+	case KindCanceled:
+		return "canceled"
+	case KindDeadlineExceeded:
+		return "deadline_exceeded"
+	case KindUnavailable:
+		return "unavailable"
+	case KindUnimplemented:
+		return "unimplemented"
+	case KindInternal:
+		return "internal"
+	default:
+		return "unknown"
+	}
+}
+
+// Public is the part of an error which is safe to return to clients,
+// everything else stays in logs.
+type Public struct {
+	Message string
+	Details map[string]string
+}
+
+// WithKind sets the error kind, err is wrapped without a message if needed
+func WithKind(err error, kind Kind) error {
+	if err == nil {
+		return nil
+	}
+	e := cloneFieldsError(err)
+	e.kind = kind
+	return e
+}
+
+// WithPublic sets the message and details returned to clients instead of err.Error()
+func WithPublic(err error, msg string, details map[string]string) error {
+	if err == nil {
+		return nil
+	}
+	e := cloneFieldsError(err)
+	e.public = &Public{
+		Message: msg,
+		Details: details,
+	}
+	return e
+}
+
+// KindOf returns the kind of the outermost FieldsError in the chain
+func KindOf(err error) Kind {
+	if e := findFieldsError(err); e != nil {
+		return e.kind
+	}
+	return KindUnknown
+}
+
+// PublicOf returns the public part of err, the message is empty when none was set
+func PublicOf(err error) Public {
+	if e := findFieldsError(err); e != nil && e.public != nil {
+		return *e.public
+	}
+	return Public{}
+}
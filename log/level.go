@@ -0,0 +1,86 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+)
+
+// levelCore gates the whole tee of sinks with the logger level. Sinks are built
+// enabled at Debug, so a per-request override only has to replace the gate and
+// it is kept by every logger derived with With.
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func newLevelCore(core zapcore.Core, level zapcore.LevelEnabler) *levelCore {
+	return &levelCore{
+		Core:  core,
+		level: level,
+	}
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level)
+}
+
+func (c *levelCore) Level() zapcore.Level {
+	return zapcore.LevelOf(c.level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{
+		Core:  c.Core.With(fields),
+		level: c.level,
+	}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// debugEnabler adds Debug entries to what level enables, so SetLevel still
+// applies to the other levels of a WithDebug logger
+type debugEnabler struct {
+	level zapcore.LevelEnabler
+}
+
+func (e debugEnabler) Enabled(level zapcore.Level) bool {
+	return level == zapcore.DebugLevel || e.level.Enabled(level)
+}
+
+// withDebug enables Debug entries regardless of the logger level
+func withDebug(core zapcore.Core) zapcore.Core {
+	c, ok := core.(*levelCore)
+	if !ok {
+		return core
+	}
+	if _, ok := c.level.(debugEnabler); ok {
+		return c
+	}
+	return &levelCore{
+		Core:  c.Core,
+		level: debugEnabler{level: c.level},
+	}
+}
+
+// WithDebug returns a logger writing Debug lines whatever the configured level
+// is, other levels follow SetLevel
+func (l *Log) WithDebug() *Log {
+	return l.copyWithEntry(*l.logger.WithOptions(zap.WrapCore(withDebug)))
+}
+
+// SetLevel changes the level of the logger and all loggers derived from it
+func (l *Log) SetLevel(level string) error {
+	return l.level.UnmarshalText([]byte(level))
+}
+
+// LevelHandler serves the current level on GET and changes it on PUT,
+// see zap.AtomicLevel.ServeHTTP for the request format.
+func (l *Log) LevelHandler() http.Handler {
+	return l.level
+}
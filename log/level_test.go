@@ -0,0 +1,53 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithDebugFollowsSetLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	l := New(Config{LogLevel: "info", OutputPaths: []string{path}})
+	if l == nil {
+		t.Fatal("New returned nil")
+	}
+	defer l.Close()
+
+	debug := l.WithDebug()
+	debug.Debug("debug 1")
+	l.Debug("hidden 1")
+	debug.Info("info 1")
+
+	if err := l.SetLevel("error"); err != nil {
+		t.Fatal(err)
+	}
+	debug.Debug("debug 2")
+	debug.Info("hidden 2")
+	l.Info("hidden 3")
+	debug.Error("error 1")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		for _, msg := range []string{"debug 1", "debug 2", "info 1", "error 1", "hidden 1", "hidden 2", "hidden 3"} {
+			if strings.Contains(line, `"`+msg+`"`) {
+				got = append(got, msg)
+			}
+		}
+	}
+	want := []string{"debug 1", "info 1", "debug 2", "error 1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
+
+func TestDefaultLevelIsDebug(t *testing.T) {
+	if got := Default().level.Level().String(); got != "debug" {
+		t.Errorf("Default level = %s, want debug", got)
+	}
+}
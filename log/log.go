@@ -2,6 +2,7 @@ package log
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"go.uber.org/zap"
@@ -10,6 +11,7 @@ import (
 	"os/signal"
 	"runtime/debug"
 	"syscall"
+	"time"
 )
 
 const (
@@ -17,6 +19,8 @@ const (
 	DebugField        = "_debug"
 	VersionField      = "_version"
 	DefaultCallerSkip = 2
+
+	defaultSamplingThereafter = 100
 )
 
 type Logger interface {
@@ -49,6 +53,9 @@ func init() {
 		for {
 			<-signals
 			glog.Info("Log Rotate signal received")
+			if err := ReopenFiles(); err != nil {
+				glog.Errorw("error reopening log files", "error", err)
+			}
 		}
 	}()
 }
@@ -58,79 +65,191 @@ type Config struct {
 	ContextLogFields []string `mapstructure:"context_log_fields"`
 	CallerSkip       int
 
+	// OutputPaths are file paths or stdout/stderr, stderr is used when empty
+	OutputPaths    []string `mapstructure:"output_paths"`
+	FileMaxSizeMB  int
+	FileMaxAge     time.Duration
+	FileMaxBackups int
+
+	// Encoding is json (default), console or logfmt
+	Encoding   string
+	MessageKey string
+	LevelKey   string
+	TimeKey    string
+	CallerKey  string
+	// TimeFormat is a zap time encoder name (iso8601, rfc3339, epoch...) or a time layout
+	TimeFormat string
+
+	// SamplingInitial and SamplingThereafter enable zap sampling per second when
+	// SamplingInitial > 0: the first SamplingInitial entries with the same level
+	// and message are logged, then every SamplingThereafter-th, 100 when zero
+	SamplingInitial    int
+	SamplingThereafter int
+
+	ServiceName  string
+	Version      string
+	StaticFields Fld `mapstructure:"static_fields"`
+
 	SentryDSN               string `mapstructure:"sentry_dsn"`
 	SentryEnableBreadcrumbs bool
 	SentryMaxBreadcrumbs    int
+	SentryFlushTimeout      time.Duration
 
 	TgChatID       int64
 	TgToken        string
 	TgMsgParseMode string
 	TgAppName      string
+	TgBaseURL      string
+	// TgBatchInterval is the minimal delay between two Telegram messages
+	TgBatchInterval time.Duration
+	TgMaxBatch      int
 }
 
 type Log struct {
 	logger    *zap.SugaredLogger
 	Config    Config
 	loggerStd *zap.Logger
-	debug     bool
+	level     zap.AtomicLevel
+	files     []*FileWriter
+	telegram  *telegramSender
 }
 
 type Fld map[string]any
 type SentryFld map[string]string
 
-func Default() *Log {
-	cfgDefault := zap.Config{
-		Encoding:         "json",
-		Level:            zap.NewAtomicLevelAt(zapcore.DebugLevel),
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey: "message",
-
-			LevelKey:    "level",
-			EncodeLevel: zapcore.CapitalLevelEncoder,
-
-			TimeKey:    "time",
-			EncodeTime: zapcore.ISO8601TimeEncoder,
-
-			CallerKey:    "caller",
-			EncodeCaller: zapcore.ShortCallerEncoder,
-		},
-	}
-	logger, err := cfgDefault.Build()
-	if err != nil {
-		panic(err)
+func defaultEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		MessageKey: "message",
+
+		LevelKey:    "level",
+		EncodeLevel: zapcore.CapitalLevelEncoder,
+
+		TimeKey:    "time",
+		EncodeTime: zapcore.ISO8601TimeEncoder,
+
+		CallerKey:    "caller",
+		EncodeCaller: zapcore.ShortCallerEncoder,
 	}
+}
 
-	logger = zap.New(logger.Core(), zap.AddCaller(), zap.AddCallerSkip(DefaultCallerSkip))
+// Default writes JSON to stderr at Debug level, New uses Config.LogLevel
+func Default() *Log {
+	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(defaultEncoderConfig()), zapcore.Lock(os.Stderr), zapcore.DebugLevel)
+	logger := zap.New(
+		newLevelCore(core, level),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+		zap.AddCaller(),
+		zap.AddCallerSkip(DefaultCallerSkip),
+	)
 
 	return &Log{
 		logger:    logger.Sugar(),
 		loggerStd: logger,
+		level:     level,
 		Config: Config{
 			ContextLogFields: []string{RequestIDField},
 		},
 	}
 }
 
+// New is NewWithError reporting a failure to stderr and returning nil
 func New(cfg Config) *Log {
+	l, err := NewWithError(cfg)
+	if err != nil {
+		glog.Errorw("error creating logger", "error", err)
+		return nil
+	}
+	return l
+}
+
+// NewWithError builds a logger from cfg, on error the files it opened are closed
+func NewWithError(cfg Config) (*Log, error) {
 	l := Default()
 	l.Config = cfg
 	l.Config.ContextLogFields = addStr(l.Config.ContextLogFields, RequestIDField)
+	if err := l.SetLevel(cfg.LogLevel); err != nil {
+		return nil, err
+	}
 
-	l.logger = zap.New(l.logger.Desugar().Core(), zap.AddCaller(), zap.AddCallerSkip(cfg.CallerSkip)).Sugar()
-	levelLog := l.logger.Level()
-	err := levelLog.Set(cfg.LogLevel)
+	encoder, err := newEncoder(cfg)
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	outputPaths := cfg.OutputPaths
+	if len(outputPaths) == 0 {
+		outputPaths = []string{"stderr"}
+	}
+	out, files, err := openOutputs(outputPaths, FileRotation{
+		MaxSizeMB:  cfg.FileMaxSizeMB,
+		MaxAge:     cfg.FileMaxAge,
+		MaxBackups: cfg.FileMaxBackups,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open log outputs: %w", err)
 	}
+	l.files = files
 
-	return l
+	var core zapcore.Core = zapcore.NewCore(encoder, out, zapcore.DebugLevel)
+	if cfg.SamplingInitial > 0 {
+		thereafter := cfg.SamplingThereafter
+		if thereafter <= 0 {
+			thereafter = defaultSamplingThereafter
+		}
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.SamplingInitial, thereafter)
+	}
+	cores := []zapcore.Core{core}
+	if cfg.SentryDSN != "" {
+		sentryCore, err := newSentryCore(l.Config)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("init sentry: %w", err), l.closeFiles())
+		}
+		cores = append(cores, sentryCore)
+	}
+	if cfg.TgToken != "" && cfg.TgChatID != 0 {
+		tgCore := newTelegramCore(l.Config)
+		l.telegram = tgCore.sender
+		cores = append(cores, tgCore)
+	}
+
+	l.loggerStd = zap.New(
+		newLevelCore(zapcore.NewTee(cores...), l.level),
+		zap.AddCaller(),
+		zap.AddCallerSkip(cfg.CallerSkip),
+		zap.Fields(staticFields(cfg)...),
+	)
+	l.logger = l.loggerStd.Sugar()
+
+	return l, nil
 }
+
 func (l *Log) GetZapLogger() *zap.Logger {
 	return l.loggerStd
 }
 
+// Close syncs the logger, stops the Telegram sender and closes its files, they
+// are not reopened on SIGHUP anymore
+func (l *Log) Close() error {
+	err := l.Sync()
+	if l.telegram != nil {
+		l.telegram.close()
+	}
+	return errors.Join(err, l.closeFiles())
+}
+
+func (l *Log) closeFiles() error {
+	var err error
+	for _, f := range l.files {
+		err = errors.Join(err, f.Close())
+	}
+	return err
+}
+
+// Sync flushes buffered entries, including pending Sentry events
+func (l *Log) Sync() error {
+	return l.logger.Sync()
+}
+
 func (l *Log) Info(msg string) {
 	l.logger.Info(msg)
 }
@@ -156,21 +275,15 @@ func (l *Log) Errorw(msg string, keysAndValues ...interface{}) {
 }
 
 func (l *Log) Debug(msg string) {
-	if l.debug {
-		l.logger.Debug(msg)
-	}
+	l.logger.Debug(msg)
 }
 
 func (l *Log) Debugf(msg string, args ...interface{}) {
-	if l.debug {
-		l.logger.Debugf(msg, args...)
-	}
+	l.logger.Debugf(msg, args...)
 }
 
 func (l *Log) Debugw(msg string, keysAndValues ...interface{}) {
-	if l.debug {
-		l.logger.Debugw(msg, keysAndValues)
-	}
+	l.logger.Debugw(msg, keysAndValues...)
 }
 
 func (l *Log) With(fld Fld) *Log {
@@ -185,16 +298,15 @@ func (l *Log) WithField(key string, val interface{}) *Log {
 	return l.copyWithEntry(*l.logger).With(Fld{key: val})
 }
 
+// WithSentryTags attaches tags to Sentry events, other sinks see them as a regular field
+func (l *Log) WithSentryTags(tags SentryFld) *Log {
+	return l.With(Fld{SentryTagsField: tags})
+}
+
+// WithErr adds the error with fields, code, severity, stack and wrap chain of FieldsError
 func (l *Log) WithErr(err error) *Log {
-	fields := Fld{}
-	if e, ok := err.(errWithFields); ok {
-		fields["error"] = e.Origin()
-		for k, v := range e.Fields() {
-			fields[k] = v
-		}
-	} else {
-		fields["error"] = err
-	}
+	fields := errorFields(err)
+	fields["error"] = err
 
 	return l.copyWithEntry(*l.logger).With(fields)
 }
@@ -211,6 +323,7 @@ func (l *Log) ErrWithErrorw(ctx context.Context, err error, msg string, keysAndV
 	l.WithCtx(ctx).WithErr(err).Errorw(msg, keysAndValues...)
 }
 
+// WithCtx adds fields collected by ContextWithFields and the legacy string keys from ContextLogFields
 func (l *Log) WithCtx(ctx context.Context) *Log {
 	fields := Fld{}
 	for _, key := range l.Config.ContextLogFields {
@@ -219,10 +332,13 @@ func (l *Log) WithCtx(ctx context.Context) *Log {
 			fields[key] = v
 		}
 	}
+	for k, v := range fieldsFromContext(ctx) {
+		fields[k] = v
+	}
 
 	copied := l.copyWithEntry(*l.logger).With(fields)
-	if ctx.Value(DebugField) != nil {
-		copied.debug = true
+	if DebugFromContext(ctx) {
+		copied = copied.WithDebug()
 	}
 
 	return copied
@@ -248,8 +364,12 @@ func (l *Log) LogGRPC(ctx context.Context, lvl logging.Level, msg string, fields
 
 func (l *Log) copyWithEntry(entry zap.SugaredLogger) *Log {
 	return &Log{
-		logger: &entry,
-		Config: l.Config,
+		logger:    &entry,
+		loggerStd: entry.Desugar(),
+		Config:    l.Config,
+		level:     l.level,
+		files:     l.files,
+		telegram:  l.telegram,
 	}
 }
 
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewWithErrorFailures(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "unknown level", cfg: Config{LogLevel: "loud"}},
+		{name: "unknown encoding", cfg: Config{Encoding: "xml"}},
+		{name: "output is a directory", cfg: Config{OutputPaths: []string{filepath.Join(dir, "ok.log"), dir}}},
+		{name: "bad sentry dsn", cfg: Config{OutputPaths: []string{filepath.Join(dir, "sentry.log")}, SentryDSN: "not a dsn"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewWithError(tt.cfg)
+			if err == nil {
+				l.Close()
+				t.Fatal("NewWithError = nil error")
+			}
+			if New(tt.cfg) != nil {
+				t.Error("New returned a logger")
+			}
+
+			// files opened before the failure are closed and not reopened on SIGHUP
+			filesMu.Lock()
+			defer filesMu.Unlock()
+			for w := range files {
+				if strings.HasPrefix(w.path, dir) {
+					t.Errorf("%s still registered", w.path)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSamplingThereafterDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	l, err := NewWithError(Config{LogLevel: "info", OutputPaths: []string{path}, SamplingInitial: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for range 2 * defaultSamplingThereafter {
+		l.Info("repeated")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first entry and every defaultSamplingThereafter-th after it
+	if got := strings.Count(string(data), "repeated"); got != 2 {
+		t.Errorf("logged %d entries, want 2", got)
+	}
+}
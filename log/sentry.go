@@ -0,0 +1,187 @@
+package log
+
+import (
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap/zapcore"
+	"time"
+)
+
+const (
+	SentryTagsField           = "_sentry_tags"
+	defaultSentryFlushTimeout = 2 * time.Second
+	sentryMaxErrorDepth       = 10
+)
+
+// sentryCore sends Error-and-above entries to Sentry as events and, when
+// breadcrumbs are enabled, records lower entries as breadcrumbs on the same hub.
+// Loggers derived with With get a clone of the hub, so breadcrumbs of one
+// request logger don't end up on events of another.
+type sentryCore struct {
+	zapcore.LevelEnabler
+	hub          *sentry.Hub
+	contextKeys  []string
+	fields       []zapcore.Field
+	flushTimeout time.Duration
+	breadcrumbs  bool
+}
+
+func newSentryCore(cfg Config) (*sentryCore, error) {
+	maxBreadcrumbs := cfg.SentryMaxBreadcrumbs
+	if !cfg.SentryEnableBreadcrumbs {
+		maxBreadcrumbs = -1
+	}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:            cfg.SentryDSN,
+		MaxBreadcrumbs: maxBreadcrumbs,
+		MaxErrorDepth:  sentryMaxErrorDepth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var enabler zapcore.LevelEnabler = zapcore.ErrorLevel
+	if cfg.SentryEnableBreadcrumbs {
+		enabler = zapcore.DebugLevel
+	}
+	flushTimeout := cfg.SentryFlushTimeout
+	if flushTimeout <= 0 {
+		flushTimeout = defaultSentryFlushTimeout
+	}
+
+	return &sentryCore{
+		LevelEnabler: enabler,
+		hub:          sentry.NewHub(client, sentry.NewScope()),
+		contextKeys:  cfg.ContextLogFields,
+		flushTimeout: flushTimeout,
+		breadcrumbs:  cfg.SentryEnableBreadcrumbs,
+	}, nil
+}
+
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.hub = c.hub.Clone()
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+func (c *sentryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sentryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	all = append(all, fields...)
+
+	tags, extra, errs := c.splitFields(all)
+
+	if ent.Level < zapcore.ErrorLevel {
+		if c.breadcrumbs {
+			c.hub.AddBreadcrumb(&sentry.Breadcrumb{
+				Category:  ent.LoggerName,
+				Message:   ent.Message,
+				Data:      extra,
+				Level:     sentryLevel(ent.Level),
+				Timestamp: ent.Time,
+			}, nil)
+		}
+		return nil
+	}
+
+	event := sentry.NewEvent()
+	event.Level = sentryLevel(ent.Level)
+	event.Message = ent.Message
+	event.Logger = ent.LoggerName
+	event.Timestamp = ent.Time
+	event.Tags = tags
+	event.Extra = extra
+	setExceptions(event, errs)
+	c.hub.CaptureEvent(event)
+
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// setExceptions adds the unwrap chain of every error, SetException alone
+// replaces the exceptions of the previous one
+func setExceptions(event *sentry.Event, errs []error) {
+	for _, err := range errs {
+		chain := sentry.NewEvent()
+		chain.SetException(err, sentryMaxErrorDepth)
+
+		offset := len(event.Exception)
+		for _, exception := range chain.Exception {
+			if m := exception.Mechanism; m != nil {
+				m.ExceptionID += offset
+				if m.ParentID != nil {
+					m.ParentID = sentry.Pointer(*m.ParentID + offset)
+				}
+			}
+		}
+		event.Exception = append(event.Exception, chain.Exception...)
+	}
+}
+
+func (c *sentryCore) Sync() error {
+	c.hub.Flush(c.flushTimeout)
+	return nil
+}
+
+// splitFields turns context fields and SentryFld values into tags, errors
+// into exceptions and everything else into extra data.
+func (c *sentryCore) splitFields(fields []zapcore.Field) (map[string]string, map[string]any, []error) {
+	enc := zapcore.NewMapObjectEncoder()
+	errs := make([]error, 0)
+	for _, f := range fields {
+		if f.Type == zapcore.ErrorType {
+			if err, ok := f.Interface.(error); ok {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		f.AddTo(enc)
+	}
+
+	tags := make(map[string]string)
+	extra := make(map[string]any, len(enc.Fields))
+	for k, v := range enc.Fields {
+		if sentryTags, ok := v.(SentryFld); ok {
+			for tk, tv := range sentryTags {
+				tags[tk] = tv
+			}
+			continue
+		}
+		extra[k] = v
+	}
+	for _, key := range c.contextKeys {
+		if v, ok := extra[key]; ok {
+			tags[key] = fmt.Sprint(v)
+			delete(extra, key)
+		}
+	}
+
+	return tags, extra, errs
+}
+
+func sentryLevel(level zapcore.Level) sentry.Level {
+	switch level {
+	case zapcore.DebugLevel:
+		return sentry.LevelDebug
+	case zapcore.InfoLevel:
+		return sentry.LevelInfo
+	case zapcore.WarnLevel:
+		return sentry.LevelWarning
+	case zapcore.ErrorLevel:
+		return sentry.LevelError
+	default:
+		return sentry.LevelFatal
+	}
+}
@@ -0,0 +1,212 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// sentryServer is a local Sentry endpoint collecting events of the envelopes it receives
+type sentryServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	events []sentry.Event
+}
+
+func newSentryServer(t *testing.T) *sentryServer {
+	t.Helper()
+	s := &sentryServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.receive))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sentryServer) dsn() string {
+	return "http://public@" + strings.TrimPrefix(s.URL, "http://") + "/1"
+}
+
+// receive reads an envelope, every item is a header line and a payload line
+func (s *sentryServer) receive(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	scanner.Scan() // envelope header
+	for scanner.Scan() {
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || !scanner.Scan() {
+			break
+		}
+		if header.Type != "event" {
+			continue
+		}
+		var event sentry.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.events = append(s.events, event)
+		s.mu.Unlock()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *sentryServer) received() []sentry.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentry.Event(nil), s.events...)
+}
+
+func newTestSentryCore(t *testing.T, cfg Config) (*sentryCore, *sentryServer) {
+	t.Helper()
+	server := newSentryServer(t)
+	cfg.SentryDSN = server.dsn()
+	core, err := newSentryCore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return core, server
+}
+
+func TestSentryCoreReportsEveryError(t *testing.T) {
+	core, server := newTestSentryCore(t, Config{ContextLogFields: []string{RequestIDField}})
+
+	first := errors.New("first")
+	second := fmt.Errorf("second: %w", errors.New("cause"))
+	err := core.Write(
+		zapcore.Entry{Level: zapcore.ErrorLevel, Message: "failed", Time: time.Now()},
+		[]zapcore.Field{
+			zap.NamedError("first", first),
+			zap.NamedError("second", second),
+			zap.String(RequestIDField, "req-1"),
+			zap.Any(SentryTagsField, SentryFld{"team": "core"}),
+			zap.Int("attempt", 3),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.Sync()
+
+	events := server.received()
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want 1", len(events))
+	}
+	event := events[0]
+
+	values := make([]string, 0, len(event.Exception))
+	for _, exception := range event.Exception {
+		values = append(values, exception.Value)
+	}
+	want := []string{"first", "cause", "second: cause"}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("exceptions = %q, want %q", values, want)
+	}
+	for i, exception := range event.Exception[1:] {
+		if exception.Mechanism == nil || exception.Mechanism.ExceptionID != i+1 {
+			t.Errorf("exception %d mechanism = %+v", i+1, exception.Mechanism)
+		}
+	}
+
+	if event.Tags[RequestIDField] != "req-1" || event.Tags["team"] != "core" {
+		t.Errorf("tags = %v", event.Tags)
+	}
+	if event.Extra["attempt"] != float64(3) {
+		t.Errorf("extra = %v", event.Extra)
+	}
+}
+
+func TestSentryCoreMaxBreadcrumbs(t *testing.T) {
+	core, server := newTestSentryCore(t, Config{SentryEnableBreadcrumbs: true, SentryMaxBreadcrumbs: 2})
+
+	entries := []zapcore.Entry{
+		{Level: zapcore.InfoLevel, Message: "step 1"},
+		{Level: zapcore.InfoLevel, Message: "step 2"},
+		{Level: zapcore.WarnLevel, Message: "step 3"},
+		{Level: zapcore.ErrorLevel, Message: "failed"},
+	}
+	for _, ent := range entries {
+		if err := core.Write(ent, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	core.Sync()
+
+	events := server.received()
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want 1", len(events))
+	}
+	breadcrumbs := events[0].Breadcrumbs
+	if len(breadcrumbs) != 2 || breadcrumbs[0].Message != "step 2" || breadcrumbs[1].Level != sentry.LevelWarning {
+		t.Errorf("breadcrumbs = %+v", breadcrumbs)
+	}
+}
+
+func TestNewSendsToSentry(t *testing.T) {
+	server := newSentryServer(t)
+	l := New(Config{
+		LogLevel:                "debug",
+		OutputPaths:             []string{filepath.Join(t.TempDir(), "app.log")},
+		SentryDSN:               server.dsn(),
+		SentryEnableBreadcrumbs: true,
+		SentryMaxBreadcrumbs:    10,
+	})
+	if l == nil {
+		t.Fatal("New returned nil")
+	}
+	defer l.Close()
+
+	// two request loggers used concurrently keep their breadcrumbs apart
+	var wg sync.WaitGroup
+	for _, req := range []string{"a", "b"} {
+		reqLog := l.With(Fld{"req": req})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reqLog.Info("step " + req)
+			reqLog.Errorw("failed "+req, "error", errors.New("boom "+req))
+		}()
+	}
+	wg.Wait()
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := server.received()
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2", len(events))
+	}
+	for _, event := range events {
+		req := strings.TrimPrefix(event.Message, "failed ")
+		if len(event.Breadcrumbs) != 1 || event.Breadcrumbs[0].Message != "step "+req {
+			t.Errorf("%s breadcrumbs = %+v", event.Message, event.Breadcrumbs)
+		}
+		if len(event.Exception) != 1 || event.Exception[0].Value != "boom "+req {
+			t.Errorf("%s exceptions = %+v", event.Message, event.Exception)
+		}
+		if event.Level != sentry.LevelError {
+			t.Errorf("%s level = %s", event.Message, event.Level)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	TgParseModeMarkdownV2 = "MarkdownV2"
+	TgParseModeMarkdown   = "Markdown"
+	TgParseModeHTML       = "HTML"
+
+	defaultTgBaseURL       = "https://api.telegram.org"
+	defaultTgBatchInterval = 5 * time.Second
+	defaultTgMaxBatch      = 10
+	tgMaxMessageLen        = 4096
+	tgQueueSize            = 256
+	tgRequestTimeout       = 10 * time.Second
+	// tgSuffixReserve keeps room for the "... and N more" line of a cut batch
+	tgSuffixReserve = 64
+)
+
+// telegramCore posts Error-and-above entries to a Telegram chat via the Bot API.
+// Entries are batched by telegramSender so a burst ends up in a single message.
+type telegramCore struct {
+	zapcore.LevelEnabler
+	sender *telegramSender
+	fields []zapcore.Field
+}
+
+func newTelegramCore(cfg Config) *telegramCore {
+	return &telegramCore{
+		LevelEnabler: zapcore.ErrorLevel,
+		sender:       newTelegramSender(cfg),
+	}
+}
+
+func (c *telegramCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+func (c *telegramCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *telegramCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	c.sender.enqueue(tgEntry{level: ent.Level, message: ent.Message, fields: enc.Fields})
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *telegramCore) Sync() error {
+	return c.sender.flush()
+}
+
+// tgEntry is rendered when its batch is sent, so escaping matches the parse
+// mode the message is actually sent with
+type tgEntry struct {
+	level   zapcore.Level
+	message string
+	fields  map[string]any
+}
+
+type telegramSender struct {
+	client    *http.Client
+	url       string
+	chatID    int64
+	parseMode string
+	appName   string
+	interval  time.Duration
+	maxBatch  int
+
+	entries    chan tgEntry
+	flushes    chan chan error
+	suppressed atomic.Int64
+
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func newTelegramSender(cfg Config) *telegramSender {
+	baseURL := cfg.TgBaseURL
+	if baseURL == "" {
+		baseURL = defaultTgBaseURL
+	}
+	interval := cfg.TgBatchInterval
+	if interval <= 0 {
+		interval = defaultTgBatchInterval
+	}
+	maxBatch := cfg.TgMaxBatch
+	if maxBatch <= 0 {
+		maxBatch = defaultTgMaxBatch
+	}
+
+	s := &telegramSender{
+		client:    &http.Client{Timeout: tgRequestTimeout},
+		url:       fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(baseURL, "/"), cfg.TgToken),
+		chatID:    cfg.TgChatID,
+		parseMode: tgParseMode(cfg.TgMsgParseMode),
+		appName:   cfg.TgAppName,
+		interval:  interval,
+		maxBatch:  maxBatch,
+		entries:   make(chan tgEntry, tgQueueSize),
+		flushes:   make(chan chan error),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+// tgParseMode returns the Bot API spelling of mode matched case-insensitively,
+// an unknown mode sends plain text
+func tgParseMode(mode string) string {
+	for _, known := range []string{TgParseModeMarkdownV2, TgParseModeMarkdown, TgParseModeHTML} {
+		if strings.EqualFold(mode, known) {
+			return known
+		}
+	}
+	return ""
+}
+
+func (s *telegramSender) enqueue(entry tgEntry) {
+	select {
+	case s.entries <- entry:
+	default:
+		s.suppressed.Add(1)
+	}
+}
+
+func (s *telegramSender) flush() error {
+	done := make(chan error, 1)
+	select {
+	case s.flushes <- done:
+	case <-s.stopped:
+		return nil
+	case <-time.After(tgRequestTimeout):
+		return fmt.Errorf("telegram flush timeout")
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(tgRequestTimeout):
+		return fmt.Errorf("telegram flush timeout")
+	}
+}
+
+// close sends the pending batch and stops run, entries logged after it are dropped
+func (s *telegramSender) close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.stopped
+	})
+}
+
+// run sends at most one message per interval, everything that arrives in
+// between is batched and entries above maxBatch are only counted.
+func (s *telegramSender) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	pending := make([]tgEntry, 0, s.maxBatch)
+	var notBefore time.Time
+	send := func() error {
+		if len(pending) == 0 && s.suppressed.Load() == 0 {
+			return nil
+		}
+		if time.Now().Before(notBefore) {
+			return fmt.Errorf("telegram rate limited until %s", notBefore.Format(time.RFC3339))
+		}
+		retryAfter, err := s.send(s.batchText(pending))
+		if retryAfter > 0 {
+			notBefore = time.Now().Add(retryAfter)
+			return err
+		}
+		pending = pending[:0]
+		return err
+	}
+
+	add := func(entry tgEntry) {
+		if len(pending) >= s.maxBatch {
+			s.suppressed.Add(1)
+			return
+		}
+		pending = append(pending, entry)
+	}
+	drain := func() {
+		for {
+			select {
+			case entry := <-s.entries:
+				add(entry)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case entry := <-s.entries:
+			add(entry)
+		case <-ticker.C:
+			if err := send(); err != nil {
+				fmt.Fprintf(os.Stderr, "telegram log sink: %v\n", err)
+			}
+		case done := <-s.flushes:
+			drain()
+			done <- send()
+		case <-s.stop:
+			drain()
+			if err := send(); err != nil {
+				fmt.Fprintf(os.Stderr, "telegram log sink: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// batchText joins whole entries while they fit into a message, the rest are
+// counted as suppressed. Only an entry too long on its own is cut, then the
+// message is rendered as plain text and sent without parse mode, a cut entity
+// or escape would be rejected.
+func (s *telegramSender) batchText(pending []tgEntry) (string, string) {
+	var b strings.Builder
+	size := 0
+	write := func(text string) {
+		b.WriteString(text)
+		size += utf8.RuneCountInString(text)
+	}
+	if s.appName != "" {
+		write(s.bold(s.appName, s.parseMode) + "\n")
+	}
+
+	var dropped int64
+	for i, entry := range pending {
+		sep := ""
+		if i > 0 {
+			sep = "\n\n"
+		}
+		text := s.format(entry, s.parseMode)
+		if size+utf8.RuneCountInString(sep+text) > tgMaxMessageLen-tgSuffixReserve {
+			dropped = int64(len(pending) - i)
+			if i == 0 {
+				plain := s.format(entry, "")
+				if s.appName != "" {
+					plain = s.appName + "\n" + plain
+				}
+				cut := []rune(plain)
+				cut = cut[:min(len(cut), tgMaxMessageLen-tgSuffixReserve)]
+				return string(cut) + s.moreText(dropped-1, ""), ""
+			}
+			break
+		}
+		write(sep + text)
+	}
+
+	return b.String() + s.moreText(dropped, s.parseMode), s.parseMode
+}
+
+// moreText reports entries left out of the batch, escaped for parseMode
+func (s *telegramSender) moreText(dropped int64, parseMode string) string {
+	n := s.suppressed.Swap(0) + dropped
+	if n <= 0 {
+		return ""
+	}
+	return "\n\n" + s.escape(fmt.Sprintf("... and %d more", n), parseMode)
+}
+
+type tgSendMessage struct {
+	ChatID                int64  `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode,omitempty"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type tgResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (s *telegramSender) send(text, parseMode string) (time.Duration, error) {
+	body, err := json.Marshal(tgSendMessage{
+		ChatID:                s.chatID,
+		Text:                  text,
+		ParseMode:             parseMode,
+		DisableWebPagePreview: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return 0, nil
+	}
+	var tgResp tgResponse
+	_ = json.NewDecoder(resp.Body).Decode(&tgResp)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := time.Duration(tgResp.Parameters.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = s.interval
+		}
+		return retryAfter, fmt.Errorf("telegram rate limited: %s", tgResp.Description)
+	}
+
+	return 0, fmt.Errorf("telegram send message: status %d: %s", resp.StatusCode, tgResp.Description)
+}
+
+func (s *telegramSender) format(entry tgEntry, parseMode string) string {
+	var b strings.Builder
+	b.WriteString(s.bold(entry.level.CapitalString(), parseMode))
+	b.WriteString(" ")
+	b.WriteString(s.escape(entry.message, parseMode))
+
+	keys := make([]string, 0, len(entry.fields))
+	for k := range entry.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString("\n")
+		b.WriteString(s.code(k, parseMode))
+		b.WriteString(s.escape(fmt.Sprintf(": %v", entry.fields[k]), parseMode))
+	}
+
+	return b.String()
+}
+
+func (s *telegramSender) bold(text, parseMode string) string {
+	switch parseMode {
+	case TgParseModeMarkdownV2, TgParseModeMarkdown:
+		return "*" + s.escape(text, parseMode) + "*"
+	case TgParseModeHTML:
+		return "<b>" + s.escape(text, parseMode) + "</b>"
+	default:
+		return text
+	}
+}
+
+func (s *telegramSender) code(text, parseMode string) string {
+	switch parseMode {
+	case TgParseModeMarkdownV2:
+		return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(text) + "`"
+	case TgParseModeMarkdown:
+		// legacy Markdown has no escaping inside entities
+		return "`" + strings.ReplaceAll(text, "`", "'") + "`"
+	case TgParseModeHTML:
+		return "<code>" + s.escape(text, parseMode) + "</code>"
+	default:
+		return text
+	}
+}
+
+var (
+	tgMarkdownV2Replacer = strings.NewReplacer(
+		"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+		"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+		"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+	)
+	tgMarkdownReplacer = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+	tgHTMLReplacer     = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+func (s *telegramSender) escape(text, parseMode string) string {
+	switch parseMode {
+	case TgParseModeMarkdownV2:
+		return tgMarkdownV2Replacer.Replace(text)
+	case TgParseModeMarkdown:
+		return tgMarkdownReplacer.Replace(text)
+	case TgParseModeHTML:
+		return tgHTMLReplacer.Replace(text)
+	default:
+		return text
+	}
+}
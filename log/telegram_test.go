@@ -0,0 +1,144 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func errEntries(messages ...string) []tgEntry {
+	entries := make([]tgEntry, 0, len(messages))
+	for _, msg := range messages {
+		entries = append(entries, tgEntry{level: zapcore.ErrorLevel, message: msg})
+	}
+	return entries
+}
+
+func TestTelegramBatchText(t *testing.T) {
+	long := strings.Repeat("x.", tgMaxMessageLen)
+	entry := strings.Repeat("y", 1000)
+	plainEntry := "ERROR " + entry
+
+	tests := []struct {
+		name       string
+		parseMode  string
+		appName    string
+		pending    []tgEntry
+		suppressed int64
+		wantText   string
+		wantMode   string
+	}{
+		{
+			name:      "joins entries",
+			parseMode: TgParseModeHTML,
+			appName:   "app",
+			pending:   errEntries("first", "a<b"),
+			wantText:  "<b>app</b>\n<b>ERROR</b> first\n\n<b>ERROR</b> a&lt;b",
+			wantMode:  TgParseModeHTML,
+		},
+		{
+			name:       "counts suppressed",
+			parseMode:  TgParseModeMarkdownV2,
+			pending:    errEntries("first"),
+			suppressed: 2,
+			wantText:   "*ERROR* first\n\n\\.\\.\\. and 2 more",
+			wantMode:   TgParseModeMarkdownV2,
+		},
+		{
+			name:      "parse mode matched case-insensitively",
+			parseMode: "markdownv2",
+			pending:   errEntries("v1.2"),
+			wantText:  "*ERROR* v1\\.2",
+			wantMode:  TgParseModeMarkdownV2,
+		},
+		{
+			name:      "unknown parse mode sends plain text",
+			parseMode: "rich",
+			pending:   errEntries("a<b"),
+			wantText:  "ERROR a<b",
+			wantMode:  "",
+		},
+		{
+			name:      "drops whole entries which don't fit",
+			parseMode: TgParseModeHTML,
+			pending:   errEntries(entry, entry, entry, entry, entry),
+			wantText:  strings.Repeat("<b>ERROR</b> "+entry+"\n\n", 2) + "<b>ERROR</b> " + entry + "\n\n... and 2 more",
+			wantMode:  TgParseModeHTML,
+		},
+		{
+			name:      "cuts a single long entry as plain text",
+			parseMode: TgParseModeMarkdownV2,
+			appName:   "app",
+			pending:   errEntries(long, "next"),
+			wantText:  ("app\n" + "ERROR " + long)[:tgMaxMessageLen-tgSuffixReserve] + "\n\n... and 1 more",
+			wantMode:  "",
+		},
+		{
+			name:     "plain entry fits",
+			pending:  errEntries(entry),
+			wantText: plainEntry,
+			wantMode: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &telegramSender{parseMode: tgParseMode(tt.parseMode), appName: tt.appName}
+			s.suppressed.Store(tt.suppressed)
+
+			text, mode := s.batchText(tt.pending)
+			if text != tt.wantText {
+				t.Errorf("text = %.80q... (%d runes), want %.80q... (%d runes)",
+					text, utf8.RuneCountInString(text), tt.wantText, utf8.RuneCountInString(tt.wantText))
+			}
+			if mode != tt.wantMode {
+				t.Errorf("parse mode = %q, want %q", mode, tt.wantMode)
+			}
+			if n := utf8.RuneCountInString(text); n > tgMaxMessageLen {
+				t.Errorf("text has %d runes", n)
+			}
+			if s.suppressed.Load() != 0 {
+				t.Errorf("suppressed = %d, want 0", s.suppressed.Load())
+			}
+		})
+	}
+}
+
+func TestTelegramSenderCloseSendsPending(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		messages []tgSendMessage
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg tgSendMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		mu.Lock()
+		messages = append(messages, msg)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := newTelegramSender(Config{TgBaseURL: srv.URL, TgToken: "token", TgChatID: 1, TgBatchInterval: time.Hour})
+	s.enqueue(tgEntry{level: zapcore.ErrorLevel, message: "first"})
+	s.enqueue(tgEntry{level: zapcore.ErrorLevel, message: "second"})
+	s.close()
+	s.close()
+
+	select {
+	case <-s.stopped:
+	default:
+		t.Fatal("run is not stopped")
+	}
+	if err := s.flush(); err != nil {
+		t.Errorf("flush after close = %v", err)
+	}
+	if len(messages) != 1 || messages[0].Text != "ERROR first\n\nERROR second" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
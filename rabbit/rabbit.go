@@ -1,6 +1,7 @@
 package rabbit
 
 import (
+	"context"
 	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -35,12 +36,23 @@ func NewRabbitCh(config Config) (*Conn, error) {
 	}, nil
 }
 
+// QueueName is the queue of uniqueKey declared by DeclareAndBindQueue, it is
+// also the routing key of PublishTo
+func (c *Conn) QueueName(uniqueKey string) string {
+	return fmt.Sprintf("%s.%s", c.cfg.QueuePattern, uniqueKey)
+}
+
+// Exchange is the exchange of the config
+func (c *Conn) Exchange() string {
+	return c.cfg.Exchange
+}
+
 func (c *Conn) DeclareAndBindQueue(uniqueKey, eName string) error {
 	if eName == "" {
 		eName = c.cfg.Exchange
 	}
 	_, err := c.QueueDeclare(
-		fmt.Sprintf("%s.%s", c.cfg.QueuePattern, uniqueKey),
+		c.QueueName(uniqueKey),
 		false,
 		true,
 		false,
@@ -52,8 +64,8 @@ func (c *Conn) DeclareAndBindQueue(uniqueKey, eName string) error {
 	}
 
 	err = c.QueueBind(
-		fmt.Sprintf("%s.%s", c.cfg.QueuePattern, uniqueKey),
-		fmt.Sprintf("%s.%s", c.cfg.QueuePattern, uniqueKey),
+		c.QueueName(uniqueKey),
+		c.QueueName(uniqueKey),
 		eName,
 		false,
 		nil,
@@ -65,6 +77,14 @@ func (c *Conn) DeclareAndBindQueue(uniqueKey, eName string) error {
 	return nil
 }
 
+// PublishTo sends body to the queue of uniqueKey through the config exchange
+func (c *Conn) PublishTo(ctx context.Context, uniqueKey string, body []byte) error {
+	return c.PublishWithContext(ctx, c.cfg.Exchange, c.QueueName(uniqueKey), false, false, amqp.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
 func (c *Conn) Close() error {
 	if err := c.Channel.Close(); err != nil {
 		return err
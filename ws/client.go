@@ -3,25 +3,94 @@ package ws
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"golang.org/x/sync/errgroup"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// SlowConsumerPolicy decides what Send does when the outbound queue of a client is full
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerDrop drops the message and returns ErrSlowConsumer
+	SlowConsumerDrop SlowConsumerPolicy = iota
+	// SlowConsumerDisconnect closes the client and returns ErrSlowConsumer
+	SlowConsumerDisconnect
+	// SlowConsumerBlock waits up to ClientConfig.BlockTimeout for free space
+	SlowConsumerBlock
+)
+
+type ClientConfig struct {
+	// QueueSize is the capacity of the outbound queue used by Send
+	QueueSize    int
+	SlowPolicy   SlowConsumerPolicy
+	BlockTimeout time.Duration
+	// Control handles control messages before ProcessRead, nil passes everything through
+	Control ControlHandler
+
+	// WriteWait is the deadline of a single write, default 15s
+	WriteWait time.Duration
+	// PongWait is how long the peer may stay silent, every pong extends the read deadline by it, default 10s
+	PongWait time.Duration
+	// PingPeriod must be less than PongWait, default 9/10 of PongWait
+	PingPeriod time.Duration
+	// MaxMessageSize is the read limit, a larger message closes the connection, default 64KiB
+	MaxMessageSize int64
+}
+
+func (cfg ClientConfig) withDefaults() ClientConfig {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = defaultBlockTimeout
+	}
+	if cfg.WriteWait <= 0 {
+		cfg.WriteWait = defaultWriteWait
+	}
+	if cfg.PongWait <= 0 {
+		cfg.PongWait = defaultPongWait
+	}
+	if cfg.PingPeriod <= 0 {
+		cfg.PingPeriod = (cfg.PongWait * 9) / 10
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = defaultMaxMessageSize
+	}
+	return cfg
+}
+
+func (cfg ClientConfig) validate() error {
+	cfg = cfg.withDefaults()
+	if cfg.PingPeriod >= cfg.PongWait {
+		return fmt.Errorf("%w: ping period %s, pong wait %s", ErrPingPeriod, cfg.PingPeriod, cfg.PongWait)
+	}
+	return nil
+}
+
 type DefaultClient struct {
-	conn *websocket.Conn
-	id   string
+	conn     *websocket.Conn
+	id       string
+	uniqueID string
+	cfg      ClientConfig
 
 	deadSignal chan string
 	closeChan  chan error
+	outbound   chan []byte
+	done       chan struct{}
+	// managerDone stops waiting for the Manager to take deadSignal after it is closed
+	managerDone <-chan struct{}
 
 	pipeProcessor PipeProcessor
 	logger        Logger
 
-	close atomic.Bool
-	mu    sync.Mutex
+	close   atomic.Bool
+	mu      sync.Mutex
+	writeMu sync.Mutex
 }
 
 func NewDefaultClient(
@@ -31,26 +100,48 @@ func NewDefaultClient(
 	pipeProcessor PipeProcessor,
 	logger Logger,
 ) *DefaultClient {
+	return NewDefaultClientWithConfig(conn, id, "", deadSignal, pipeProcessor, logger, ClientConfig{})
+}
+
+// NewDefaultClientWithConfig is NewDefaultClient with the uniqueID returned by
+// GetUniqueID and the outbound queue, timeouts and read limit of cfg
+func NewDefaultClientWithConfig(
+	conn *websocket.Conn,
+	id string,
+	uniqueID string,
+	deadSignal chan string,
+	pipeProcessor PipeProcessor,
+	logger Logger,
+	cfg ClientConfig,
+) *DefaultClient {
+	cfg = cfg.withDefaults()
 	return &DefaultClient{
 		conn:          conn,
 		id:            id,
+		uniqueID:      uniqueID,
+		cfg:           cfg,
 		pipeProcessor: pipeProcessor,
 		deadSignal:    deadSignal,
 		logger:        logger,
 		closeChan:     make(chan error, 1),
+		outbound:      make(chan []byte, cfg.QueueSize),
+		done:          make(chan struct{}),
 		close:         atomic.Bool{},
 		mu:            sync.Mutex{},
 	}
 }
 func (c *DefaultClient) Configure() error {
-	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadLimit(c.cfg.MaxMessageSize)
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait)); err != nil {
+		return err
+	}
 	c.conn.SetCloseHandler(func(code int, text string) error {
 		c.logger.Infow("connection closed", "code", code, "text", text)
 		return c.Close()
 
 	})
 	c.conn.SetPongHandler(func(appData string) error {
-		err := c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		err := c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
 		if err != nil {
 			c.logger.Errorw("error setting read deadline", "error", err)
 			return err
@@ -64,11 +155,15 @@ func (c *DefaultClient) Configure() error {
 
 func (c *DefaultClient) Run(ctx context.Context) error {
 	defer func() {
+		close(c.done)
 		err := c.conn.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			c.logger.Errorw("error closing connection", "error", err)
 		}
-		c.deadSignal <- c.GetClientID()
+		select {
+		case c.deadSignal <- c.GetClientID():
+		case <-c.managerDone:
+		}
 	}()
 
 	if err := c.Configure(); err != nil {
@@ -79,6 +174,9 @@ func (c *DefaultClient) Run(ctx context.Context) error {
 	errGroup.Go(func() error {
 		select {
 		case <-ctx.Done():
+			// ReadMessage doesn't watch ctx, closing the connection stops ReadPipe
+			// when another pipe fails
+			c.conn.Close()
 			return nil
 		case err := <-c.closeChan:
 			return err
@@ -113,6 +211,15 @@ func (c *DefaultClient) ReadPipe(ctx context.Context) error {
 				}
 				return errors.Join(err, ErrUnknownReadException)
 			}
+			if c.cfg.Control != nil {
+				if answer, ok := c.cfg.Control.HandleControl(ctx, c, messageType, msg); ok {
+					if err := c.write(answer); err != nil {
+						return errors.Join(err, ErrWriteAnswer)
+					}
+					continue
+				}
+			}
+
 			answer, err := c.pipeProcessor.ProcessRead(ctx, messageType, msg)
 			if err != nil {
 				// TODO: Add Circuit Breaker and close connection when always error
@@ -124,7 +231,7 @@ func (c *DefaultClient) ReadPipe(ctx context.Context) error {
 				continue
 			}
 
-			err = c.conn.WriteMessage(websocket.TextMessage, answer)
+			err = c.write(answer)
 			if err != nil {
 				return errors.Join(err, ErrWriteAnswer)
 			}
@@ -140,10 +247,19 @@ func (c *DefaultClient) WritePipe(ctx context.Context) error {
 			return nil
 		case msg, ok := <-c.pipeProcessor.ListenWrite(ctx):
 			if !ok {
-				return nil
+				// the processor lost its source, e.g. a broker channel, the client reconnects to a new one
+				return ErrWritePipeClosed
 			}
 
-			err := c.conn.WriteMessage(websocket.TextMessage, msg)
+			err := c.write(msg)
+			if acknowledger, ok := c.pipeProcessor.(WriteAcknowledger); ok {
+				acknowledger.AckWrite(ctx, msg, err)
+			}
+			if err != nil {
+				return errors.Join(err, ErrWriteAnswer)
+			}
+		case msg := <-c.outbound:
+			err := c.write(msg)
 			if err != nil {
 				return errors.Join(err, ErrWriteAnswer)
 			}
@@ -152,7 +268,7 @@ func (c *DefaultClient) WritePipe(ctx context.Context) error {
 }
 
 func (c *DefaultClient) Ping(ctx context.Context) error {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.cfg.PingPeriod)
 	defer ticker.Stop()
 	for {
 		select {
@@ -160,18 +276,29 @@ func (c *DefaultClient) Ping(ctx context.Context) error {
 			c.logger.Infow("Ping ctx done", "ctxErr", ctx.Err(), "clientID", c.GetClientID())
 			return nil
 		case <-ticker.C:
-			err := c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err != nil {
+			if err := c.ping(); err != nil {
 				return err
 			}
-			err = c.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait))
-			if err != nil {
-				return errors.Join(err, ErrWriteAnswer)
-			}
 		}
 	}
 }
 
+// ping holds writeMu, the write deadline is shared with write
+func (c *DefaultClient) ping() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
+	if err != nil {
+		return err
+	}
+	err = c.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(c.cfg.WriteWait))
+	if err != nil {
+		return errors.Join(err, ErrWriteAnswer)
+	}
+	return nil
+}
+
 func (c *DefaultClient) Close() error {
 	defer c.mu.Unlock()
 	c.mu.Lock()
@@ -186,6 +313,56 @@ func (c *DefaultClient) Close() error {
 	return c.conn.Close()
 }
 
+// Send queues msg for WritePipe, a full queue is handled by ClientConfig.SlowPolicy
+func (c *DefaultClient) Send(msg []byte) error {
+	if c.close.Load() {
+		return ErrClientClosed
+	}
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	case c.outbound <- msg:
+		return nil
+	default:
+	}
+
+	switch c.cfg.SlowPolicy {
+	case SlowConsumerDisconnect:
+		c.logger.Errorw("disconnecting slow consumer", "clientID", c.GetClientID(), "uniqueID", c.uniqueID)
+		return errors.Join(ErrSlowConsumer, c.Close())
+	case SlowConsumerBlock:
+		timer := time.NewTimer(c.cfg.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case <-c.done:
+			return ErrClientClosed
+		case c.outbound <- msg:
+			return nil
+		case <-timer.C:
+			return ErrSlowConsumer
+		}
+	default:
+		return ErrSlowConsumer
+	}
+}
+
+// write serializes writes of ReadPipe answers and WritePipe messages
+func (c *DefaultClient) write(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
 func (c *DefaultClient) GetClientID() string {
 	return c.id
 }
+
+// GetUniqueID returns the uniqueID passed to Manager.Process, e.g. the user id
+func (c *DefaultClient) GetUniqueID() string {
+	return c.uniqueID
+}
@@ -10,4 +10,11 @@ var (
 	ErrUnknownReadException     = errors.New("unknown read exception")
 	ErrWriteAnswer              = errors.New("error write answer")
 	ErrCreateConnTimeout        = errors.New("error create connection timeout")
+	ErrClientClosed             = errors.New("client is closed")
+	ErrSlowConsumer             = errors.New("client outbound queue is full")
+	ErrClientNotFound           = errors.New("client not found")
+	ErrUserNotFound             = errors.New("user has no connections")
+	ErrPingPeriod               = errors.New("ping period must be less than pong wait")
+	ErrWritePipeClosed          = errors.New("write pipe is closed")
+	ErrConnsLimit               = errors.New("conns limit must be positive")
 )
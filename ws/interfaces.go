@@ -17,10 +17,17 @@ type ReadPipeProcessor interface {
 	ProcessRead(ctx context.Context, messageType int, msg []byte) ([]byte, error)
 }
 
+// WritePipeProcessor closing the ListenWrite channel closes the client
 type WritePipeProcessor interface {
 	ListenWrite(ctx context.Context) <-chan []byte
 }
 
+// WriteAcknowledger is implemented by a PipeProcessor which needs the result of
+// writing a ListenWrite message to the websocket, e.g. to ack a broker delivery
+type WriteAcknowledger interface {
+	AckWrite(ctx context.Context, msg []byte, err error)
+}
+
 type PipeProcessorFabric interface {
 	NewPipeProcessor(ctx context.Context, uniqueID string) (PipeProcessor, error)
 }
@@ -30,3 +37,22 @@ type Client interface {
 	Run(ctx context.Context) error
 	Close() error
 }
+
+// SendClient is a Client the Manager can queue messages for, e.g. DefaultClient
+type SendClient interface {
+	Client
+	GetUniqueID() string
+	Send(msg []byte) error
+}
+
+// ControlHandler takes messages meant for the Manager itself, e.g. room
+// subscriptions, before they reach PipeProcessor.ProcessRead
+type ControlHandler interface {
+	HandleControl(ctx context.Context, client SendClient, messageType int, msg []byte) (answer []byte, handled bool)
+}
+
+// ClientFilter selects clients for Manager.Broadcast, nil selects all
+type ClientFilter func(SendClient) bool
+
+// UserHook is called by the Manager when uniqueID comes online or goes offline
+type UserHook func(uniqueID string, online bool)
@@ -3,10 +3,13 @@ package ws
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/MikhailGulkin/packages/log"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"net/http"
+	"slices"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,27 +18,83 @@ import (
 type Manager struct {
 	upgrader        websocket.Upgrader
 	processorFabric PipeProcessorFabric
-	clients         map[string]Client
+	clientCfg       ClientConfig
+	// connCreateTimeout limits Process waiting for the pipe processor
+	connCreateTimeout time.Duration
+	// connsLimit is the expected number of connections, maps are sized by it
+	connsLimit int
+	clients    map[string]SendClient
+	// users maps uniqueID to ids of its clients
+	users map[string]map[string]struct{}
+	// rooms maps room name to ids of subscribed clients, clientRooms is the reverse
+	rooms       map[string]map[string]struct{}
+	clientRooms map[string]map[string]struct{}
+	userHooks   []UserHook
 
 	isClosed   atomic.Bool
+	closeOnce  sync.Once
+	done       chan struct{}
 	deadSignal chan string
 	mu         sync.Mutex
 	logger     Logger
 }
 
+// NewManager replaces a ping period set by options that is not less than the
+// pong wait and a conns limit below one with the defaults, use
+// NewManagerWithOptions to get ErrPingPeriod and ErrConnsLimit
 func NewManager(
 	opts ...OptionFunc,
 ) *Manager {
+	manager := newManager(opts...)
+	if manager.connsLimit <= 0 {
+		manager.logger.Errorw("invalid conns limit, using the default", "error", ErrConnsLimit, "limit", manager.connsLimit)
+		manager.connsLimit = defaultConnsLimit
+	}
+	if err := manager.clientCfg.validate(); err != nil {
+		manager.logger.Errorw("invalid client config, using the default ping period", "error", err)
+		manager.clientCfg.PingPeriod = 0
+	}
+	manager.init()
+	return manager
+}
+
+// NewManagerWithOptions is NewManager returning ErrPingPeriod when the ping
+// period set by options is not less than the pong wait and ErrConnsLimit when
+// the conns limit is below one
+func NewManagerWithOptions(opts ...OptionFunc) (*Manager, error) {
+	manager := newManager(opts...)
+	if manager.connsLimit <= 0 {
+		return nil, ErrConnsLimit
+	}
+	if err := manager.clientCfg.validate(); err != nil {
+		return nil, err
+	}
+	manager.init()
+	return manager, nil
+}
+
+func newManager(opts ...OptionFunc) *Manager {
 	manager := &Manager{
-		upgrader:        websocket.Upgrader{},
-		processorFabric: &PipeProcessorFabricImpl{},
-		clients:         make(map[string]Client, defaultConnsLimit),
-		deadSignal:      make(chan string, defaultConnsLimit),
-		logger:          log.Default(),
-		mu:              sync.Mutex{},
-		isClosed:        atomic.Bool{},
+		upgrader:          websocket.Upgrader{},
+		processorFabric:   &PipeProcessorFabricImpl{},
+		connCreateTimeout: defaultConnCreateTimeout,
+		connsLimit:        defaultConnsLimit,
+		logger:            log.Default(),
+		mu:                sync.Mutex{},
+		isClosed:          atomic.Bool{},
 	}
-	return manager.With(opts...)
+	manager.With(opts...)
+	return manager
+}
+
+// init makes the maps and channels sized by the validated options
+func (m *Manager) init() {
+	m.clients = make(map[string]SendClient, m.connsLimit)
+	m.users = make(map[string]map[string]struct{}, m.connsLimit)
+	m.rooms = make(map[string]map[string]struct{})
+	m.clientRooms = make(map[string]map[string]struct{})
+	m.deadSignal = make(chan string, m.connsLimit)
+	m.done = make(chan struct{})
 }
 
 func (m *Manager) Process(uniqueID string, w http.ResponseWriter, r *http.Request, header http.Header) error {
@@ -63,8 +122,9 @@ func (m *Manager) Process(uniqueID string, w http.ResponseWriter, r *http.Reques
 			}
 		}()
 
-		client := NewDefaultClient(conn, uuid.New().String(), m.deadSignal, processor, m.logger)
-		m.addClient(client.GetClientID(), client)
+		client := NewDefaultClientWithConfig(conn, uuid.New().String(), uniqueID, m.deadSignal, processor, m.logger, m.clientCfg)
+		client.managerDone = m.done
+		m.addClient(client)
 		c <- nil
 		err = client.Run(context.WithoutCancel(r.Context()))
 		if err != nil {
@@ -79,52 +139,174 @@ func (m *Manager) Process(uniqueID string, w http.ResponseWriter, r *http.Reques
 			return errors.Join(err, conn.Close())
 		}
 		return nil
-	case <-time.After(connCreateTimeout):
+	case <-time.After(m.connCreateTimeout):
 		return ErrCreateConnTimeout
 	}
 }
-func (m *Manager) addClient(id string, client Client) {
+func (m *Manager) addClient(client SendClient) {
+	m.mu.Lock()
+	m.clients[client.GetClientID()] = client
+
+	ids, ok := m.users[client.GetUniqueID()]
+	if !ok {
+		ids = make(map[string]struct{})
+		m.users[client.GetUniqueID()] = ids
+	}
+	ids[client.GetClientID()] = struct{}{}
+	hooks := m.userHooks
+	m.mu.Unlock()
+
+	if !ok {
+		notifyUser(hooks, client.GetUniqueID(), true)
+	}
+}
+
+// removeClient must be called with mu held, it reports whether it was the
+// last connection of the uniqueID
+func (m *Manager) removeClient(client SendClient) bool {
+	delete(m.clients, client.GetClientID())
+	m.leaveAll(client.GetClientID())
+	if ids, ok := m.users[client.GetUniqueID()]; ok {
+		delete(ids, client.GetClientID())
+		if len(ids) == 0 {
+			delete(m.users, client.GetUniqueID())
+			return true
+		}
+	}
+	return false
+}
+
+// OnUserChange adds a hook called after a uniqueID gets its first connection
+// or loses its last one. Hooks run on the goroutines of Process and Run
+// without the manager lock held, they must not block.
+func (m *Manager) OnUserChange(hook UserHook) {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+	m.userHooks = append(slices.Clip(m.userHooks), hook)
+}
+
+func notifyUser(hooks []UserHook, uniqueID string, online bool) {
+	for _, hook := range hooks {
+		hook(uniqueID, online)
+	}
+}
+
+// Users returns the uniqueIDs with at least one connection to this manager
+func (m *Manager) Users() []string {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+
+	users := make([]string, 0, len(m.users))
+	for uniqueID := range m.users {
+		users = append(users, uniqueID)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// HasUser reports whether the uniqueID has a connection to this manager
+func (m *Manager) HasUser(uniqueID string) bool {
 	defer m.mu.Unlock()
 	m.mu.Lock()
-	m.clients[id] = client
+	_, ok := m.users[uniqueID]
+	return ok
+}
+
+// SendTo queues msg for one connection
+func (m *Manager) SendTo(clientID string, msg []byte) error {
+	m.mu.Lock()
+	client, ok := m.clients[clientID]
+	m.mu.Unlock()
+	if !ok {
+		return ErrClientNotFound
+	}
+	return client.Send(msg)
+}
+
+// SendToUser queues msg for every connection of the uniqueID passed to Process
+func (m *Manager) SendToUser(uniqueID string, msg []byte) error {
+	m.mu.Lock()
+	clients := make([]SendClient, 0, len(m.users[uniqueID]))
+	for id := range m.users[uniqueID] {
+		clients = append(clients, m.clients[id])
+	}
+	m.mu.Unlock()
+	if len(clients) == 0 {
+		return ErrUserNotFound
+	}
+	return sendAll(clients, msg)
+}
+
+// Broadcast queues msg for every client accepted by filter, errors of slow
+// clients are joined and don't stop the delivery to others
+func (m *Manager) Broadcast(msg []byte, filter ClientFilter) error {
+	m.mu.Lock()
+	clients := make([]SendClient, 0, len(m.clients))
+	for _, client := range m.clients {
+		if filter == nil || filter(client) {
+			clients = append(clients, client)
+		}
+	}
+	m.mu.Unlock()
+	return sendAll(clients, msg)
+}
+
+// sendAll is called without mu held, Send may block or close the client
+func sendAll(clients []SendClient, msg []byte) error {
+	var err error
+	for _, client := range clients {
+		if sendErr := client.Send(msg); sendErr != nil {
+			err = errors.Join(err, fmt.Errorf("client %s: %w", client.GetClientID(), sendErr))
+		}
+	}
+	return err
 }
 func (m *Manager) Run(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case id, ok := <-m.deadSignal:
+		case <-m.done:
+			return
+		case id := <-m.deadSignal:
+			m.mu.Lock()
+			client, ok := m.clients[id]
 			if !ok {
-				return
+				m.mu.Unlock()
+				m.logger.Errorw("DefaultClient not found", "id", id)
+				continue
+			}
+			offline := m.removeClient(client)
+			hooks := m.userHooks
+			m.mu.Unlock()
+
+			if offline {
+				notifyUser(hooks, client.GetUniqueID(), false)
 			}
-			func() {
-				defer m.mu.Unlock()
-				m.mu.Lock()
-				_, ok := m.clients[id]
-				if !ok {
-					m.logger.Errorw("DefaultClient not found", "id", id)
-					return
-				}
-				delete(m.clients, id)
-			}()
 		}
 	}
 }
 
+// Close closes every client, calls after the first one return nil
 func (m *Manager) Close() error {
-	defer m.mu.Unlock()
-	m.mu.Lock()
-
 	var err error
-	m.isClosed.Store(true)
-	for id, client := range m.clients {
-		err := client.Close()
-		if err != nil {
-			m.logger.Errorw("error closing connection", "error", err)
-			err = errors.Join(err, err)
+	m.closeOnce.Do(func() {
+		defer m.mu.Unlock()
+		m.mu.Lock()
+
+		m.isClosed.Store(true)
+		for id, client := range m.clients {
+			if closeErr := client.Close(); closeErr != nil {
+				m.logger.Errorw("error closing connection", "error", closeErr)
+				err = errors.Join(err, closeErr)
+			}
+			delete(m.clients, id)
 		}
-		delete(m.clients, id)
-	}
-	close(m.deadSignal)
+		clear(m.users)
+		clear(m.rooms)
+		clear(m.clientRooms)
+		// deadSignal stays open, clients still running may send to it
+		close(m.done)
+	})
 	return err
 }
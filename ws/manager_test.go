@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type silentFabric struct{}
+
+func (silentFabric) NewPipeProcessor(context.Context, string) (PipeProcessor, error) {
+	return NewProcessorImpl(&ReadPipeProcessorImpl{}, &WritePipeProcessorImpl{send: make(chan []byte)}), nil
+}
+
+func newTestManager(t *testing.T, opts ...OptionFunc) (*Manager, *httptest.Server) {
+	t.Helper()
+	m, err := NewManagerWithOptions(append([]OptionFunc{WithProcessorFabric(silentFabric{})}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := m.Process(r.URL.Query().Get("user"), w, r, nil); err != nil {
+			t.Errorf("Process: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return m, server
+}
+
+func dial(t *testing.T, server *httptest.Server, user string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?user=" + user
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerSendWhilePinging(t *testing.T) {
+	m, server := newTestManager(t, WithPing(time.Millisecond, 50*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	defer m.Close()
+
+	conn := dial(t, server, "alice")
+	waitFor(t, "alice", func() bool { return m.HasUser("alice") })
+
+	const messages = 50
+	go func() {
+		for i := 0; i < messages; i++ {
+			if err := m.SendToUser("alice", []byte("hello")); err != nil {
+				t.Errorf("SendToUser: %v", err)
+			}
+		}
+	}()
+	for i := 0; i < messages; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hello" {
+			t.Fatalf("ReadMessage = %q, %v", msg, err)
+		}
+	}
+}
+
+func TestManagerCloseTwice(t *testing.T) {
+	m, server := newTestManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(stopped)
+	}()
+
+	conn := dial(t, server, "bob")
+	waitFor(t, "bob", func() bool { return m.HasUser("bob") })
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't return after Close")
+	}
+
+	// the client goroutine sends its dead signal after Run stopped taking them
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("connection still open after Close")
+	}
+	if err := m.SendToUser("bob", []byte("late")); err != ErrUserNotFound {
+		t.Errorf("SendToUser after Close = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestNewManagerPingPeriod(t *testing.T) {
+	if _, err := NewManagerWithOptions(WithPing(time.Second, time.Second)); !errors.Is(err, ErrPingPeriod) {
+		t.Errorf("NewManagerWithOptions = %v, want %v", err, ErrPingPeriod)
+	}
+
+	m := NewManager(WithPing(time.Second, time.Second))
+	cfg := m.clientCfg.withDefaults()
+	if cfg.PingPeriod >= cfg.PongWait {
+		t.Errorf("ping period %s, pong wait %s", cfg.PingPeriod, cfg.PongWait)
+	}
+}
+
+func TestNewManagerConnsLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		if _, err := NewManagerWithOptions(WithConnsLimit(limit)); !errors.Is(err, ErrConnsLimit) {
+			t.Errorf("NewManagerWithOptions(%d) = %v, want %v", limit, err, ErrConnsLimit)
+		}
+		if m := NewManager(WithConnsLimit(limit)); m.connsLimit != defaultConnsLimit {
+			t.Errorf("NewManager(%d) conns limit = %d, want %d", limit, m.connsLimit, defaultConnsLimit)
+		}
+	}
+}
+
+// closingFabric hands out write channels of its processors, closing one stops its source
+type closingFabric struct {
+	sends chan chan []byte
+}
+
+func (f closingFabric) NewPipeProcessor(context.Context, string) (PipeProcessor, error) {
+	send := make(chan []byte)
+	f.sends <- send
+	return NewProcessorImpl(&ReadPipeProcessorImpl{}, &WritePipeProcessorImpl{send: send}), nil
+}
+
+func TestClientClosesWithWritePipe(t *testing.T) {
+	fabric := closingFabric{sends: make(chan chan []byte, 1)}
+	m, server := newTestManager(t, WithProcessorFabric(fabric))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	defer m.Close()
+
+	conn := dial(t, server, "carol")
+	waitFor(t, "carol", func() bool { return m.HasUser("carol") })
+
+	close(<-fabric.sends)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("connection still open after the write pipe closed")
+	}
+	waitFor(t, "carol removed", func() bool { return !m.HasUser("carol") })
+}
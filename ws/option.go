@@ -1,5 +1,11 @@
 package ws
 
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
 type OptionFunc func(*Manager)
 
 func (m *Manager) With(opt ...OptionFunc) *Manager {
@@ -14,3 +20,120 @@ func WithProcessorFabric(fabric PipeProcessorFabric) OptionFunc {
 		m.processorFabric = fabric
 	}
 }
+
+// WithOutboundQueue sets the capacity of the per client queue used by SendTo,
+// SendToUser and Broadcast
+func WithOutboundQueue(size int) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.QueueSize = size
+	}
+}
+
+// WithSlowConsumerPolicy sets what happens when a client queue is full, blockTimeout
+// is used by SlowConsumerBlock only
+func WithSlowConsumerPolicy(policy SlowConsumerPolicy, blockTimeout time.Duration) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.SlowPolicy = policy
+		m.clientCfg.BlockTimeout = blockTimeout
+	}
+}
+
+// WithRoomControl lets clients subscribe to rooms with ControlMessage frames,
+// authorize may be nil to allow every room
+func WithRoomControl(authorize RoomAuthorizer) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.Control = &roomControl{manager: m, authorize: authorize}
+	}
+}
+
+// WithReadLimit sets the maximum size of a message read from a client, a larger one closes the connection
+func WithReadLimit(size int64) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.MaxMessageSize = size
+	}
+}
+
+// WithWriteWait sets the deadline of a single write to a client
+func WithWriteWait(wait time.Duration) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.WriteWait = wait
+	}
+}
+
+// WithPing sets how often clients are pinged and how long they may stay silent,
+// pingPeriod must be less than pongWait, zero pingPeriod is 9/10 of pongWait
+func WithPing(pingPeriod, pongWait time.Duration) OptionFunc {
+	return func(m *Manager) {
+		m.clientCfg.PingPeriod = pingPeriod
+		m.clientCfg.PongWait = pongWait
+	}
+}
+
+// WithConnCreateTimeout limits how long Process waits for the pipe processor of a new connection
+func WithConnCreateTimeout(timeout time.Duration) OptionFunc {
+	return func(m *Manager) {
+		m.connCreateTimeout = timeout
+	}
+}
+
+// WithConnsLimit sizes the connection maps of NewManager and the buffer of
+// disconnect signals, it is not a hard limit and must be positive
+func WithConnsLimit(limit int) OptionFunc {
+	return func(m *Manager) {
+		m.connsLimit = limit
+	}
+}
+
+// WithHandshakeTimeout limits the websocket handshake of Process
+func WithHandshakeTimeout(timeout time.Duration) OptionFunc {
+	return func(m *Manager) {
+		m.upgrader.HandshakeTimeout = timeout
+	}
+}
+
+// WithBufferSizes sets the I/O buffer sizes of connections, zero keeps the
+// buffers of the HTTP server. They don't limit the message size.
+func WithBufferSizes(read, write int) OptionFunc {
+	return func(m *Manager) {
+		m.upgrader.ReadBufferSize = read
+		m.upgrader.WriteBufferSize = write
+	}
+}
+
+// WithSubprotocols sets the subprotocols the server supports in order of preference
+func WithSubprotocols(subprotocols ...string) OptionFunc {
+	return func(m *Manager) {
+		m.upgrader.Subprotocols = subprotocols
+	}
+}
+
+// WithCheckOrigin replaces the default check which rejects cross-origin requests
+func WithCheckOrigin(check func(r *http.Request) bool) OptionFunc {
+	return func(m *Manager) {
+		m.upgrader.CheckOrigin = check
+	}
+}
+
+// WithAllowedOrigins accepts requests without an Origin header or with one of
+// origins, e.g. https://example.com, compared case-insensitively. "*" allows every origin.
+func WithAllowedOrigins(origins ...string) OptionFunc {
+	return WithCheckOrigin(func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithCompression negotiates per message compression (RFC 7692) with clients supporting it
+func WithCompression(enable bool) OptionFunc {
+	return func(m *Manager) {
+		m.upgrader.EnableCompression = enable
+	}
+}
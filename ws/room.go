@@ -0,0 +1,144 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"sort"
+)
+
+const (
+	ControlSubscribe    = "subscribe"
+	ControlUnsubscribe  = "unsubscribe"
+	ControlSubscribed   = "subscribed"
+	ControlUnsubscribed = "unsubscribed"
+	ControlError        = "error"
+)
+
+// ControlMessage is a text frame {"control":"subscribe","room":"chat-1"} sent by a
+// client, answered with the same shape and control subscribed, unsubscribed or error
+type ControlMessage struct {
+	Control string `json:"control"`
+	Room    string `json:"room,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RoomAuthorizer reports whether the user may subscribe to room
+type RoomAuthorizer func(ctx context.Context, uniqueID, room string) bool
+
+// Join subscribes a connection to room, the room is created on first join
+func (m *Manager) Join(clientID, room string) error {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+
+	if _, ok := m.clients[clientID]; !ok {
+		return ErrClientNotFound
+	}
+	members, ok := m.rooms[room]
+	if !ok {
+		members = make(map[string]struct{})
+		m.rooms[room] = members
+	}
+	members[clientID] = struct{}{}
+
+	joined, ok := m.clientRooms[clientID]
+	if !ok {
+		joined = make(map[string]struct{})
+		m.clientRooms[clientID] = joined
+	}
+	joined[room] = struct{}{}
+	return nil
+}
+
+// Leave unsubscribes a connection, empty rooms are removed
+func (m *Manager) Leave(clientID, room string) {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+	m.leave(clientID, room)
+}
+
+// leave must be called with mu held
+func (m *Manager) leave(clientID, room string) {
+	if members, ok := m.rooms[room]; ok {
+		delete(members, clientID)
+		if len(members) == 0 {
+			delete(m.rooms, room)
+		}
+	}
+	if joined, ok := m.clientRooms[clientID]; ok {
+		delete(joined, room)
+		if len(joined) == 0 {
+			delete(m.clientRooms, clientID)
+		}
+	}
+}
+
+// leaveAll must be called with mu held
+func (m *Manager) leaveAll(clientID string) {
+	for room := range m.clientRooms[clientID] {
+		m.leave(clientID, room)
+	}
+}
+
+// Members returns ids of connections subscribed to room
+func (m *Manager) Members(room string) []string {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+
+	ids := make([]string, 0, len(m.rooms[room]))
+	for id := range m.rooms[room] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PublishToRoom queues msg for every member, like Broadcast errors of slow clients are joined
+func (m *Manager) PublishToRoom(room string, msg []byte) error {
+	m.mu.Lock()
+	clients := make([]SendClient, 0, len(m.rooms[room]))
+	for id := range m.rooms[room] {
+		clients = append(clients, m.clients[id])
+	}
+	m.mu.Unlock()
+	return sendAll(clients, msg)
+}
+
+// roomControl handles ControlMessage frames before PipeProcessor.ProcessRead
+type roomControl struct {
+	manager   *Manager
+	authorize RoomAuthorizer
+}
+
+func (r *roomControl) HandleControl(ctx context.Context, client SendClient, messageType int, msg []byte) ([]byte, bool) {
+	if messageType != websocket.TextMessage || !bytes.Contains(msg, []byte(`"control"`)) {
+		return nil, false
+	}
+	var control ControlMessage
+	if err := json.Unmarshal(msg, &control); err != nil {
+		return nil, false
+	}
+
+	answer := ControlMessage{Room: control.Room}
+	switch {
+	case control.Control != ControlSubscribe && control.Control != ControlUnsubscribe:
+		return nil, false
+	case control.Room == "":
+		answer.Control, answer.Error = ControlError, "room is empty"
+	case control.Control == ControlUnsubscribe:
+		r.manager.Leave(client.GetClientID(), control.Room)
+		answer.Control = ControlUnsubscribed
+	case r.authorize != nil && !r.authorize(ctx, client.GetUniqueID(), control.Room):
+		answer.Control, answer.Error = ControlError, "forbidden"
+	default:
+		if err := r.manager.Join(client.GetClientID(), control.Room); err != nil {
+			answer.Control, answer.Error = ControlError, err.Error()
+			break
+		}
+		answer.Control = ControlSubscribed
+	}
+
+	data, _ := json.Marshal(answer)
+	return data, true
+}
@@ -0,0 +1,212 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeClient records sent messages instead of writing to a connection
+type fakeClient struct {
+	id, uniqueID string
+	sent         []string
+}
+
+func (c *fakeClient) GetClientID() string {
+	return c.id
+}
+
+func (c *fakeClient) GetUniqueID() string {
+	return c.uniqueID
+}
+
+func (c *fakeClient) Run(context.Context) error {
+	return nil
+}
+
+func (c *fakeClient) Close() error {
+	return nil
+}
+
+func (c *fakeClient) Send(msg []byte) error {
+	c.sent = append(c.sent, string(msg))
+	return nil
+}
+
+func newRoomManager(t *testing.T, clients ...*fakeClient) *Manager {
+	t.Helper()
+	m, err := NewManagerWithOptions(WithProcessorFabric(silentFabric{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range clients {
+		m.addClient(client)
+	}
+	return m
+}
+
+func TestJoinLeave(t *testing.T) {
+	alice, bob := &fakeClient{id: "a1", uniqueID: "alice"}, &fakeClient{id: "b1", uniqueID: "bob"}
+	m := newRoomManager(t, alice, bob)
+
+	if err := m.Join("missing", "chat"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Join of an unknown client = %v, want %v", err, ErrClientNotFound)
+	}
+	for _, id := range []string{"a1", "b1"} {
+		if err := m.Join(id, "chat"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Join("a1", "news"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Members("chat"); !slices.Equal(got, []string{"a1", "b1"}) {
+		t.Errorf("chat members = %v", got)
+	}
+
+	m.Leave("a1", "chat")
+	m.Leave("a1", "news")
+	if got := m.Members("chat"); !slices.Equal(got, []string{"b1"}) {
+		t.Errorf("chat members after leave = %v", got)
+	}
+	if _, ok := m.rooms["news"]; ok {
+		t.Error("empty room news not removed")
+	}
+	if _, ok := m.clientRooms["a1"]; ok {
+		t.Error("a1 still has rooms")
+	}
+}
+
+func TestPublishToRoom(t *testing.T) {
+	alice, bob, carol := &fakeClient{id: "a1"}, &fakeClient{id: "b1"}, &fakeClient{id: "c1"}
+	m := newRoomManager(t, alice, bob, carol)
+	for _, id := range []string{"a1", "b1"} {
+		if err := m.Join(id, "chat"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.PublishToRoom("chat", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PublishToRoom("empty", []byte("nobody")); err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range []*fakeClient{alice, bob} {
+		if !slices.Equal(client.sent, []string{"hi"}) {
+			t.Errorf("%s got %v, want [hi]", client.id, client.sent)
+		}
+	}
+	if len(carol.sent) != 0 {
+		t.Errorf("c1 outside the room got %v", carol.sent)
+	}
+}
+
+func TestRoomControl(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType int
+		msg         string
+		wantHandled bool
+		want        ControlMessage
+		wantMember  bool
+	}{
+		{name: "binary frame", messageType: websocket.BinaryMessage, msg: `{"control":"subscribe","room":"chat"}`},
+		{name: "no control key", messageType: websocket.TextMessage, msg: `{"room":"chat"}`},
+		{name: "invalid json", messageType: websocket.TextMessage, msg: `{"control":`},
+		{name: "unknown control", messageType: websocket.TextMessage, msg: `{"control":"ping","room":"chat"}`},
+		{
+			name:        "empty room",
+			messageType: websocket.TextMessage,
+			msg:         `{"control":"subscribe"}`,
+			wantHandled: true,
+			want:        ControlMessage{Control: ControlError, Error: "room is empty"},
+		},
+		{
+			name:        "forbidden",
+			messageType: websocket.TextMessage,
+			msg:         `{"control":"subscribe","room":"secret"}`,
+			wantHandled: true,
+			want:        ControlMessage{Control: ControlError, Room: "secret", Error: "forbidden"},
+		},
+		{
+			name:        "subscribe",
+			messageType: websocket.TextMessage,
+			msg:         `{"control":"subscribe","room":"chat"}`,
+			wantHandled: true,
+			want:        ControlMessage{Control: ControlSubscribed, Room: "chat"},
+			wantMember:  true,
+		},
+		{
+			name:        "unsubscribe",
+			messageType: websocket.TextMessage,
+			msg:         `{"control":"unsubscribe","room":"chat"}`,
+			wantHandled: true,
+			want:        ControlMessage{Control: ControlUnsubscribed, Room: "chat"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice := &fakeClient{id: "a1", uniqueID: "alice"}
+			m := newRoomManager(t, alice)
+			if tt.want.Control == ControlUnsubscribed {
+				if err := m.Join("a1", "chat"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			control := &roomControl{manager: m, authorize: func(_ context.Context, uniqueID, room string) bool {
+				return uniqueID == "alice" && room != "secret"
+			}}
+
+			answer, handled := control.HandleControl(context.Background(), alice, tt.messageType, []byte(tt.msg))
+			if handled != tt.wantHandled {
+				t.Fatalf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if handled {
+				var got ControlMessage
+				if err := json.Unmarshal(answer, &got); err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("answer = %+v, want %+v", got, tt.want)
+				}
+			}
+			if member := slices.Contains(m.Members("chat"), "a1"); member != tt.wantMember {
+				t.Errorf("member = %v, want %v", member, tt.wantMember)
+			}
+		})
+	}
+}
+
+func TestDeadClientLeavesRooms(t *testing.T) {
+	m, server := newTestManager(t, WithRoomControl(nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	defer m.Close()
+
+	conn := dial(t, server, "alice")
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"control":"subscribe","room":"chat"}`)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != `{"control":"subscribed","room":"chat"}` {
+		t.Fatalf("ReadMessage = %q, %v", msg, err)
+	}
+	if len(m.Members("chat")) != 1 {
+		t.Fatalf("chat members = %v", m.Members("chat"))
+	}
+
+	conn.Close()
+	waitFor(t, "chat emptied", func() bool { return len(m.Members("chat")) == 0 })
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.rooms) != 0 || len(m.clientRooms) != 0 {
+		t.Errorf("rooms %v, client rooms %v after the client died", m.rooms, m.clientRooms)
+	}
+}
@@ -0,0 +1,284 @@
+// Package wskafka is a Kafka backplane for ws.Manager: every node consumes
+// one topic of envelopes and delivers them to its local clients, so a message
+// published on any node reaches a user, a room or all clients of the cluster.
+package wskafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/MikhailGulkin/packages/ws"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/sync/errgroup"
+	"time"
+)
+
+const (
+	KindUser      = "user"
+	KindRoom      = "room"
+	KindBroadcast = "broadcast"
+	// KindPresence is a heartbeat with the users connected to Node
+	KindPresence = "presence"
+	// KindLeave is sent by a node when it stops
+	KindLeave = "leave"
+
+	defaultGroupPrefix      = "ws-backplane"
+	defaultPresenceInterval = 5 * time.Second
+	leaveTimeout            = 5 * time.Second
+	// commitInterval bounds envelopes delivered again after a restart of a node with a stable NodeID
+	commitInterval = time.Second
+)
+
+type Config struct {
+	Brokers []string
+	Topic   string
+	// NodeID names the consumer group of the node, a random one is used when
+	// empty. A stable id resumes from the last committed envelope after restart,
+	// a random one leaves an unused group behind.
+	NodeID string
+	// GroupPrefix is prepended to NodeID, default ws-backplane
+	GroupPrefix string
+	// PresenceInterval is how often the node publishes its users, default 5s.
+	// Users connecting or disconnecting publish them right away.
+	PresenceInterval time.Duration
+	// PresenceTTL is how long a node is online after its last heartbeat, default 3 intervals
+	PresenceTTL time.Duration
+}
+
+// Envelope is the message of the topic, Payload is written to the websocket as is
+type Envelope struct {
+	Kind string `json:"kind"`
+	// Target is the uniqueID of KindUser or the room of KindRoom
+	Target  string `json:"target,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	// Node is the publisher
+	Node string `json:"node"`
+	// Users are connected to Node, KindPresence only
+	Users []string `json:"users,omitempty"`
+}
+
+// UndeliveredHandler takes envelopes for users not connected to any node,
+// e.g. to store them until the user comes back
+type UndeliveredHandler func(ctx context.Context, env Envelope) error
+
+type Backplane struct {
+	cfg         Config
+	manager     *ws.Manager
+	consumer    *consumer.Consumer
+	producer    *producer.Producer[Envelope]
+	presence    *presence
+	logger      ws.Logger
+	undelivered UndeliveredHandler
+
+	consumerOpts []consumer.OptionFunc
+	producerOpts []producer.OptionFunc[Envelope]
+
+	// usersChanged wakes heartbeat when a user connects or disconnects locally
+	usersChanged chan struct{}
+}
+
+func New(manager *ws.Manager, config Config, opts ...OptionFunc) (*Backplane, error) {
+	if config.Topic == "" {
+		return nil, ErrEmptyTopic
+	}
+	if config.NodeID == "" {
+		config.NodeID = uuid.New().String()
+	}
+	if config.GroupPrefix == "" {
+		config.GroupPrefix = defaultGroupPrefix
+	}
+	if config.PresenceInterval <= 0 {
+		config.PresenceInterval = defaultPresenceInterval
+	}
+	if config.PresenceTTL <= 0 {
+		config.PresenceTTL = 3 * config.PresenceInterval
+	}
+
+	b := &Backplane{
+		cfg:          config,
+		manager:      manager,
+		presence:     newPresence(config.PresenceTTL),
+		usersChanged: make(chan struct{}, 1),
+		logger:       log.Default(),
+	}
+	b.With(opts...)
+
+	c, err := consumer.NewConsumer(
+		consumer.Config{
+			Brokers: config.Brokers,
+			GroupID: fmt.Sprintf("%s.%s", config.GroupPrefix, config.NodeID),
+			Topics:  []string{config.Topic},
+			// envelopes published before the node started have no clients here
+			OffsetReset:    consumer.OffsetResetLatest,
+			CommitInterval: commitInterval,
+		},
+		consumer.HandlerFunc(b.handle),
+		append([]consumer.OptionFunc{
+			consumer.WithLogger(b.logger),
+			consumer.WithMiddleware(consumer.Recovery()),
+		}, b.consumerOpts...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.consumer = c
+
+	p, err := producer.New[Envelope](
+		producer.Config{
+			Brokers:  config.Brokers,
+			Topic:    config.Topic,
+			Balancer: producer.BalancerHash,
+		},
+		producer.JSONCodec[Envelope]{},
+		append([]producer.OptionFunc[Envelope]{producer.WithKey(envelopeKey)}, b.producerOpts...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.producer = p
+
+	manager.OnUserChange(b.userChanged)
+	return b, nil
+}
+
+// envelopeKey keeps envelopes of one target in order
+func envelopeKey(env Envelope) []byte {
+	switch env.Kind {
+	case KindPresence, KindLeave:
+		return []byte(env.Node)
+	default:
+		return []byte(env.Kind + ":" + env.Target)
+	}
+}
+
+// NodeID is the id this node publishes presence with
+func (b *Backplane) NodeID() string {
+	return b.cfg.NodeID
+}
+
+// Run consumes envelopes and publishes presence until ctx is canceled, then
+// announces the node is leaving. The consumer and the producer are closed when
+// Run returns.
+func (b *Backplane) Run(ctx context.Context) error {
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+	errGroup.Go(func() error {
+		return b.consumer.Run(groupCtx)
+	})
+	errGroup.Go(func() error {
+		b.heartbeat(groupCtx)
+		return nil
+	})
+	err := errGroup.Wait()
+
+	leaveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaveTimeout)
+	defer cancel()
+	if leaveErr := b.producer.Send(leaveCtx, Envelope{Kind: KindLeave, Node: b.cfg.NodeID}); leaveErr != nil {
+		b.logger.Errorw("error publishing leave", "node", b.cfg.NodeID, "error", leaveErr)
+	}
+	return errors.Join(err, b.producer.Close())
+}
+
+// heartbeat publishes the users of the node every PresenceInterval and after
+// a local user connects or disconnects, changes in between are coalesced
+func (b *Backplane) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.PresenceInterval)
+	defer ticker.Stop()
+
+	for {
+		env := Envelope{Kind: KindPresence, Node: b.cfg.NodeID, Users: b.manager.Users()}
+		if err := b.producer.Send(ctx, env); err != nil && ctx.Err() == nil {
+			b.logger.Errorw("error publishing presence", "node", b.cfg.NodeID, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.usersChanged:
+			ticker.Reset(b.cfg.PresenceInterval)
+		}
+	}
+}
+
+// userChanged is the ws.UserHook of the manager, it must not block
+func (b *Backplane) userChanged(string, bool) {
+	select {
+	case b.usersChanged <- struct{}{}:
+	default:
+	}
+}
+
+// SendToUser publishes msg for every connection of uniqueID on any node. A user
+// without connections gets ErrUserOffline, or the envelope goes to the
+// WithUndelivered handler. Presence of other nodes is as old as their last
+// publish, a user who disconnects after the check misses the message.
+func (b *Backplane) SendToUser(ctx context.Context, uniqueID string, msg []byte) error {
+	env := Envelope{Kind: KindUser, Target: uniqueID, Payload: msg, Node: b.cfg.NodeID}
+	if !b.Online(uniqueID) {
+		if b.undelivered == nil {
+			return fmt.Errorf("%w: %s", ErrUserOffline, uniqueID)
+		}
+		return b.undelivered(ctx, env)
+	}
+	return b.producer.Send(ctx, env)
+}
+
+// PublishToRoom publishes msg for the members of room on every node
+func (b *Backplane) PublishToRoom(ctx context.Context, room string, msg []byte) error {
+	return b.producer.Send(ctx, Envelope{Kind: KindRoom, Target: room, Payload: msg, Node: b.cfg.NodeID})
+}
+
+// Broadcast publishes msg for every client of every node
+func (b *Backplane) Broadcast(ctx context.Context, msg []byte) error {
+	return b.producer.Send(ctx, Envelope{Kind: KindBroadcast, Payload: msg, Node: b.cfg.NodeID})
+}
+
+// Online reports whether uniqueID is connected to this node or to a node with a live heartbeat
+func (b *Backplane) Online(uniqueID string) bool {
+	return b.manager.HasUser(uniqueID) || b.presence.online(uniqueID, time.Now())
+}
+
+// Nodes returns other nodes with a live heartbeat
+func (b *Backplane) Nodes() []string {
+	return b.presence.live(time.Now())
+}
+
+// handle never fails, an envelope that can't be delivered must not stop the node
+func (b *Backplane) handle(_ context.Context, msg kafka.Message) error {
+	env, err := producer.JSONCodec[Envelope]{}.Decode(msg.Value)
+	if err != nil {
+		b.logger.Errorw("error decoding envelope", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		return nil
+	}
+
+	switch env.Kind {
+	case KindPresence:
+		if env.Node != b.cfg.NodeID {
+			b.presence.update(env.Node, env.Users, time.Now())
+		}
+		return nil
+	case KindLeave:
+		b.presence.remove(env.Node)
+		return nil
+	case KindUser:
+		err = b.manager.SendToUser(env.Target, env.Payload)
+		if errors.Is(err, ws.ErrUserNotFound) {
+			// the user is connected to another node
+			err = nil
+		}
+	case KindRoom:
+		err = b.manager.PublishToRoom(env.Target, env.Payload)
+	case KindBroadcast:
+		err = b.manager.Broadcast(env.Payload, nil)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownKind, env.Kind)
+	}
+	if err != nil {
+		b.logger.Errorw("error delivering envelope", "kind", env.Kind, "target", env.Target, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package wskafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/kafkatest"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/ws"
+	"github.com/gorilla/websocket"
+)
+
+const testTopic = "ws-envelopes"
+
+type silentProcessor struct {
+	send chan []byte
+}
+
+func (p *silentProcessor) ProcessRead(context.Context, int, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (p *silentProcessor) ListenWrite(context.Context) <-chan []byte {
+	return p.send
+}
+
+func (p *silentProcessor) Close() error {
+	return nil
+}
+
+type silentFabric struct{}
+
+func (silentFabric) NewPipeProcessor(context.Context, string) (ws.PipeProcessor, error) {
+	return &silentProcessor{send: make(chan []byte)}, nil
+}
+
+type node struct {
+	manager   *ws.Manager
+	backplane *Backplane
+	server    *httptest.Server
+}
+
+// startNode runs a manager and a backplane with a presence interval too long to matter
+func startNode(t *testing.T, broker *kafkatest.Broker, id string) *node {
+	t.Helper()
+	manager, err := ws.NewManagerWithOptions(ws.WithProcessorFabric(silentFabric{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backplane, err := New(manager,
+		Config{Brokers: []string{"kafkatest"}, Topic: testTopic, NodeID: id, PresenceInterval: time.Hour},
+		WithConsumerOptions(consumer.WithReader(broker.Reader(defaultGroupPrefix+"."+id, testTopic))),
+		WithProducerOptions(producer.WithWriter[Envelope](broker.Writer(testTopic))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go manager.Run(ctx)
+	go func() {
+		defer close(done)
+		if err := backplane.Run(ctx); err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		manager.Close()
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Process(r.URL.Query().Get("user"), w, r, nil); err != nil {
+			t.Errorf("Process: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return &node{manager: manager, backplane: backplane, server: server}
+}
+
+func (n *node) connect(t *testing.T, user string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(n.server.URL, "http") + "?user=" + user
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBackplanePresenceOnConnect(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	a := startNode(t, broker, "a")
+	b := startNode(t, broker, "b")
+
+	conn := a.connect(t, "alice")
+	waitFor(t, "alice online on b", func() bool { return b.backplane.Online("alice") })
+
+	if err := b.backplane.SendToUser(context.Background(), "alice", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hi" {
+		t.Fatalf("ReadMessage = %q, %v", msg, err)
+	}
+
+	conn.Close()
+	waitFor(t, "alice offline on b", func() bool { return !b.backplane.Online("alice") })
+}
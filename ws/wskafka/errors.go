@@ -0,0 +1,9 @@
+package wskafka
+
+import "errors"
+
+var (
+	ErrEmptyTopic  = errors.New("topic is empty")
+	ErrUserOffline = errors.New("user is not connected to any node")
+	ErrUnknownKind = errors.New("unknown envelope kind")
+)
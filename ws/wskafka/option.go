@@ -0,0 +1,44 @@
+package wskafka
+
+import (
+	"github.com/MikhailGulkin/packages/kafka/consumer"
+	"github.com/MikhailGulkin/packages/kafka/producer"
+	"github.com/MikhailGulkin/packages/ws"
+)
+
+type OptionFunc func(*Backplane)
+
+func (b *Backplane) With(opt ...OptionFunc) *Backplane {
+	for _, o := range opt {
+		o(b)
+	}
+	return b
+}
+
+func WithLogger(logger ws.Logger) OptionFunc {
+	return func(b *Backplane) {
+		b.logger = logger
+	}
+}
+
+// WithUndelivered stores or reports envelopes of SendToUser for offline users
+// instead of returning ErrUserOffline
+func WithUndelivered(handler UndeliveredHandler) OptionFunc {
+	return func(b *Backplane) {
+		b.undelivered = handler
+	}
+}
+
+// WithConsumerOptions are applied after the defaults, e.g. consumer.WithReader with kafkatest
+func WithConsumerOptions(opts ...consumer.OptionFunc) OptionFunc {
+	return func(b *Backplane) {
+		b.consumerOpts = append(b.consumerOpts, opts...)
+	}
+}
+
+// WithProducerOptions are applied after the defaults, e.g. producer.WithWriter with kafkatest
+func WithProducerOptions(opts ...producer.OptionFunc[Envelope]) OptionFunc {
+	return func(b *Backplane) {
+		b.producerOpts = append(b.producerOpts, opts...)
+	}
+}
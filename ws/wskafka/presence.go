@@ -0,0 +1,80 @@
+package wskafka
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// presence keeps the users of other nodes from their last heartbeat
+type presence struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	nodes map[string]nodePresence
+}
+
+type nodePresence struct {
+	users map[string]struct{}
+	seen  time.Time
+}
+
+func newPresence(ttl time.Duration) *presence {
+	return &presence{
+		ttl:   ttl,
+		nodes: make(map[string]nodePresence),
+	}
+}
+
+func (p *presence) update(node string, users []string, now time.Time) {
+	set := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		set[user] = struct{}{}
+	}
+
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	p.nodes[node] = nodePresence{users: set, seen: now}
+	p.expire(now)
+}
+
+func (p *presence) remove(node string) {
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	delete(p.nodes, node)
+}
+
+func (p *presence) online(user string, now time.Time) bool {
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	p.expire(now)
+
+	for _, node := range p.nodes {
+		if _, ok := node.users[user]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *presence) live(now time.Time) []string {
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	p.expire(now)
+
+	ids := make([]string, 0, len(p.nodes))
+	for id := range p.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// expire must be called with mu held
+func (p *presence) expire(now time.Time) {
+	for id, node := range p.nodes {
+		if now.Sub(node.seen) > p.ttl {
+			delete(p.nodes, id)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package wsrabbit delivers RabbitMQ messages to websocket clients, so any
+// instance can reach a client connected to another one with rabbit.Conn.PublishTo.
+package wsrabbit
+
+import (
+	"context"
+	"errors"
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/MikhailGulkin/packages/rabbit"
+	"github.com/MikhailGulkin/packages/ws"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"sync"
+)
+
+const defaultPrefetch = 16
+
+// Fabric is a ws.PipeProcessorFabric with a channel and an exclusive queue per
+// connection, bound to the exchange with the routing key of rabbit.Conn.PublishTo.
+// Every connection of a uniqueID, on any instance, gets its own copy of a message.
+// The broker deletes the queue when the processor closes its channel.
+type Fabric struct {
+	conn     *rabbit.Conn
+	reader   ws.ReadPipeProcessor
+	logger   ws.Logger
+	exchange string
+}
+
+type OptionFunc func(*Fabric)
+
+func (f *Fabric) With(opt ...OptionFunc) *Fabric {
+	for _, o := range opt {
+		o(f)
+	}
+	return f
+}
+
+// WithReader handles messages read from the websocket, they are ignored by default
+func WithReader(reader ws.ReadPipeProcessor) OptionFunc {
+	return func(f *Fabric) {
+		f.reader = reader
+	}
+}
+
+func WithLogger(logger ws.Logger) OptionFunc {
+	return func(f *Fabric) {
+		f.logger = logger
+	}
+}
+
+// WithExchange binds queues to exchange instead of the one from rabbit.Config
+func WithExchange(exchange string) OptionFunc {
+	return func(f *Fabric) {
+		f.exchange = exchange
+	}
+}
+
+// NewFabric opens channels of conn for processors, the channel of conn itself is not used
+func NewFabric(conn *rabbit.Conn, opts ...OptionFunc) (*Fabric, error) {
+	if conn.Connection.IsClosed() {
+		return nil, amqp.ErrClosed
+	}
+	f := &Fabric{
+		conn:     conn,
+		logger:   log.Default(),
+		exchange: conn.Exchange(),
+	}
+	f.With(opts...)
+	return f, nil
+}
+
+// NewPipeProcessor opens a channel for the connection, a channel exception
+// closes only this processor and its client
+func (f *Fabric) NewPipeProcessor(ctx context.Context, uniqueID string) (ws.PipeProcessor, error) {
+	ch, err := f.conn.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := f.consume(ctx, ch, uniqueID)
+	if err != nil {
+		return nil, errors.Join(err, ch.Close())
+	}
+
+	p := newProcessor(f, uniqueID, ch)
+	go p.forward(deliveries, ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return p, nil
+}
+
+// consume declares a server named queue deleted with ch and binds it to the routing key of uniqueID
+func (f *Fabric) consume(ctx context.Context, ch *amqp.Channel, uniqueID string) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(defaultPrefetch, 0, false); err != nil {
+		return nil, err
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.QueueBind(queue.Name, f.conn.QueueName(uniqueID), f.exchange, false, nil); err != nil {
+		return nil, err
+	}
+	return ch.ConsumeWithContext(context.WithoutCancel(ctx), queue.Name, "", false, true, false, false, nil)
+}
+
+// Processor streams deliveries of one queue into ListenWrite, a delivery is
+// acked after the websocket write succeeds and requeued when it fails. The
+// ListenWrite channel is closed when the broker closes the channel, which
+// closes the client.
+type Processor struct {
+	fabric   *Fabric
+	uniqueID string
+	ch       channel
+
+	out     chan []byte
+	results chan error
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// channel is the part of *amqp.Channel a Processor uses once it consumes
+type channel interface {
+	IsClosed() bool
+	Close() error
+}
+
+func newProcessor(f *Fabric, uniqueID string, ch channel) *Processor {
+	return &Processor{
+		fabric:   f,
+		uniqueID: uniqueID,
+		ch:       ch,
+		out:      make(chan []byte),
+		results:  make(chan error),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (p *Processor) ProcessRead(ctx context.Context, messageType int, msg []byte) ([]byte, error) {
+	if p.fabric.reader == nil {
+		return nil, nil
+	}
+	return p.fabric.reader.ProcessRead(ctx, messageType, msg)
+}
+
+func (p *Processor) ListenWrite(_ context.Context) <-chan []byte {
+	return p.out
+}
+
+// AckWrite is called by ws.DefaultClient after writing a ListenWrite message
+func (p *Processor) AckWrite(_ context.Context, _ []byte, err error) {
+	select {
+	case p.results <- err:
+	case <-p.done:
+	}
+}
+
+// Close closes the channel, the broker deletes the queue with unacked deliveries
+func (p *Processor) Close() error {
+	var err error
+	p.once.Do(func() {
+		close(p.done)
+		<-p.stopped
+		if !p.ch.IsClosed() {
+			err = p.ch.Close()
+		}
+	})
+	return err
+}
+
+func (p *Processor) forward(deliveries <-chan amqp.Delivery, closed <-chan *amqp.Error) {
+	defer close(p.stopped)
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				p.closedByBroker(closed)
+				return
+			}
+			if !p.deliver(d) {
+				return
+			}
+		}
+	}
+}
+
+// deliver passes d to the client and acks it after the write, false means the processor is closed
+func (p *Processor) deliver(d amqp.Delivery) bool {
+	select {
+	case p.out <- d.Body:
+	case <-p.done:
+		return false
+	}
+
+	select {
+	case err := <-p.results:
+		if err != nil {
+			p.nack(d)
+			return true
+		}
+		if err := d.Ack(false); err != nil {
+			p.fabric.logger.Errorw("error acking delivery", "uniqueID", p.uniqueID, "error", err)
+		}
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// closedByBroker closes out, so the client stops and reconnects to a new processor
+func (p *Processor) closedByBroker(closed <-chan *amqp.Error) {
+	select {
+	case err, ok := <-closed:
+		if ok && err != nil {
+			p.fabric.logger.Errorw("rabbit channel closed", "uniqueID", p.uniqueID, "error", err)
+		}
+	default:
+		p.fabric.logger.Errorw("rabbit consumer canceled", "uniqueID", p.uniqueID)
+	}
+	close(p.out)
+}
+
+func (p *Processor) nack(d amqp.Delivery) {
+	if err := d.Nack(false, true); err != nil {
+		p.fabric.logger.Errorw("error requeueing delivery", "uniqueID", p.uniqueID, "error", err)
+	}
+}
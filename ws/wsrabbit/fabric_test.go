@@ -0,0 +1,242 @@
+package wsrabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MikhailGulkin/packages/log"
+	"github.com/MikhailGulkin/packages/ws"
+	"github.com/gorilla/websocket"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeChannel counts closes instead of closing a broker channel
+type fakeChannel struct {
+	closes atomic.Int32
+}
+
+func (c *fakeChannel) IsClosed() bool {
+	return c.closes.Load() > 0
+}
+
+func (c *fakeChannel) Close() error {
+	c.closes.Add(1)
+	return nil
+}
+
+// fakeAcknowledger reports acks and nacks of deliveries as "ack 1" or "nack 1 requeue"
+type fakeAcknowledger struct {
+	events chan string
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, _ bool) error {
+	a.events <- fmt.Sprintf("ack %d", tag)
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, _ bool, requeue bool) error {
+	if requeue {
+		a.events <- fmt.Sprintf("nack %d requeue", tag)
+	} else {
+		a.events <- fmt.Sprintf("nack %d", tag)
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// fakeConsumer is a processor forwarding deliveries pushed by the test
+type fakeConsumer struct {
+	processor  *Processor
+	ch         *fakeChannel
+	acks       *fakeAcknowledger
+	deliveries chan amqp.Delivery
+	closed     chan *amqp.Error
+}
+
+func startProcessor() *fakeConsumer {
+	c := &fakeConsumer{
+		ch:         &fakeChannel{},
+		acks:       &fakeAcknowledger{events: make(chan string, 10)},
+		deliveries: make(chan amqp.Delivery),
+		closed:     make(chan *amqp.Error, 1),
+	}
+	c.processor = newProcessor(&Fabric{logger: log.Default()}, "alice", c.ch)
+	go c.processor.forward(c.deliveries, c.closed)
+	return c
+}
+
+func (c *fakeConsumer) deliver(t *testing.T, tag uint64, body string) {
+	t.Helper()
+	select {
+	case c.deliveries <- amqp.Delivery{Acknowledger: c.acks, DeliveryTag: tag, Body: []byte(body)}:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("delivery %d not taken", tag)
+	}
+}
+
+func (c *fakeConsumer) expectAck(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-c.acks.events:
+		if got != want {
+			t.Errorf("ack = %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %q", want)
+	}
+}
+
+func receive(t *testing.T, p *Processor) ([]byte, bool) {
+	t.Helper()
+	select {
+	case msg, ok := <-p.ListenWrite(context.Background()):
+		return msg, ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing on ListenWrite")
+		return nil, false
+	}
+}
+
+func TestProcessorAcksAfterWrite(t *testing.T) {
+	c := startProcessor()
+	defer c.processor.Close()
+
+	c.deliver(t, 1, "first")
+	if msg, _ := receive(t, c.processor); string(msg) != "first" {
+		t.Fatalf("ListenWrite = %q", msg)
+	}
+	select {
+	case event := <-c.acks.events:
+		t.Fatalf("%s before the write result", event)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.processor.AckWrite(context.Background(), []byte("first"), nil)
+	c.expectAck(t, "ack 1")
+
+	// a failed write goes back to the queue
+	c.deliver(t, 2, "second")
+	receive(t, c.processor)
+	c.processor.AckWrite(context.Background(), []byte("second"), errors.New("broken pipe"))
+	c.expectAck(t, "nack 2 requeue")
+}
+
+func TestProcessorClosedByBroker(t *testing.T) {
+	c := startProcessor()
+	defer c.processor.Close()
+
+	c.closed <- &amqp.Error{Code: amqp.NotFound, Reason: "queue deleted"}
+	close(c.deliveries)
+	if _, ok := receive(t, c.processor); ok {
+		t.Fatal("ListenWrite still open after the broker closed the channel")
+	}
+}
+
+func TestProcessorCloseWhileWriting(t *testing.T) {
+	c := startProcessor()
+	c.deliver(t, 1, "first")
+	receive(t, c.processor)
+
+	// the client died before reporting the write, the delivery stays unacked
+	for range 2 {
+		if err := c.processor.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.processor.AckWrite(context.Background(), []byte("first"), nil)
+	if got := c.ch.closes.Load(); got != 1 {
+		t.Errorf("channel closed %d times, want 1", got)
+	}
+	select {
+	case event := <-c.acks.events:
+		t.Errorf("%s after Close", event)
+	default:
+	}
+}
+
+type fabricFunc func(ctx context.Context, uniqueID string) (ws.PipeProcessor, error)
+
+func (f fabricFunc) NewPipeProcessor(ctx context.Context, uniqueID string) (ws.PipeProcessor, error) {
+	return f(ctx, uniqueID)
+}
+
+// startClient connects alice to a manager whose processor is c
+func startClient(t *testing.T, c *fakeConsumer) (*ws.Manager, *websocket.Conn) {
+	t.Helper()
+	manager, err := ws.NewManagerWithOptions(ws.WithProcessorFabric(fabricFunc(func(context.Context, string) (ws.PipeProcessor, error) {
+		return c.processor, nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go manager.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		manager.Close()
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Process("alice", w, r, nil); err != nil {
+			t.Errorf("Process: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return manager, conn
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientConsumesAndAcks(t *testing.T) {
+	c := startProcessor()
+	manager, conn := startClient(t, c)
+	waitFor(t, "alice", func() bool { return manager.HasUser("alice") })
+
+	c.deliver(t, 1, "hello")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hello" {
+		t.Fatalf("ReadMessage = %q, %v", msg, err)
+	}
+	c.expectAck(t, "ack 1")
+
+	// a dead client closes its processor and with it the channel of the exclusive queue
+	conn.Close()
+	waitFor(t, "channel closed", func() bool { return c.ch.closes.Load() == 1 })
+	waitFor(t, "alice removed", func() bool { return !manager.HasUser("alice") })
+}
+
+func TestClientClosedWithBrokerChannel(t *testing.T) {
+	c := startProcessor()
+	manager, conn := startClient(t, c)
+	waitFor(t, "alice", func() bool { return manager.HasUser("alice") })
+
+	close(c.deliveries)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("connection still open after the broker channel closed")
+	}
+	waitFor(t, "alice removed", func() bool { return !manager.HasUser("alice") })
+}